@@ -0,0 +1,300 @@
+// Package bus_log publishes log entries to a message bus such as a Kafka topic
+// or NATS subject. The bus client itself is supplied by the caller as a
+// Publisher, so this package does not depend on any particular client library.
+package bus_log
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pentops/log.go/log"
+)
+
+const (
+	// SchemaVersionHeader is set on every message, allowing consumers to
+	// handle changes to the entry format.
+	SchemaVersionHeader = "log-schema-version"
+
+	// SchemaVersion is the version of the JSON entry format in the message
+	// value, see log.EntrySchema.
+	SchemaVersion = log.EntrySchemaVersion
+)
+
+// ErrClosed is returned by Close when the sink has already been closed.
+var ErrClosed = errors.New("bus sink closed")
+
+// Message is a single encoded log entry. The Key is the trace ID of the entry
+// (or empty), so that a partitioned bus keeps each request's entries in order.
+type Message struct {
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Publisher sends a batch of messages to the bus, e.g. a Kafka producer
+// writing to a topic, or a NATS connection publishing to a subject.
+type Publisher interface {
+	Publish(ctx context.Context, messages []Message) error
+}
+
+type options struct {
+	batchSize      int
+	flushInterval  time.Duration
+	bufferSize     int
+	dropWhenFull   bool
+	publishTimeout time.Duration
+	onError        func(error)
+}
+
+type Option func(*options)
+
+// WithBatchSize sets the maximum number of messages sent in one Publish call.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		o.batchSize = size
+	}
+}
+
+// WithFlushInterval sets the maximum time an entry waits for a batch to fill
+// before it is published. Zero disables timed flushes.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = interval
+	}
+}
+
+// WithBufferSize sets the number of entries held while waiting for the
+// publisher before logging applies backpressure.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		o.bufferSize = size
+	}
+}
+
+// WithDropWhenFull drops entries when the buffer is full rather than blocking
+// the log call until the publisher catches up. Dropped entries are counted,
+// see Sink.Dropped.
+func WithDropWhenFull() Option {
+	return func(o *options) {
+		o.dropWhenFull = true
+	}
+}
+
+// WithPublishTimeout sets the context timeout for each Publish call.
+func WithPublishTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.publishTimeout = timeout
+	}
+}
+
+// WithErrorHandler customizes the handling of Publish errors, which by
+// default are written to stderr.
+func WithErrorHandler(f func(error)) Option {
+	return func(o *options) {
+		o.onError = f
+	}
+}
+
+var defaultOptions = options{
+	batchSize:      100,
+	flushInterval:  time.Second,
+	bufferSize:     1000,
+	publishTimeout: 10 * time.Second,
+	onError: func(err error) {
+		fmt.Fprintf(os.Stderr, "bus_log: publish failed: %s\n", err.Error())
+	},
+}
+
+// Sink batches log entries and publishes them in the background.
+type Sink struct {
+	publisher Publisher
+	options   options
+
+	entries chan Message
+	closing chan struct{}
+	done    chan struct{}
+
+	// inFlight is held for reading by each Log call, run takes it for
+	// writing before the final drain so no entry is sent after the drain
+	inFlight  sync.RWMutex
+	closeOnce sync.Once
+
+	dropped atomic.Int64
+}
+
+// NewSink starts a sink publishing to the publisher. Sink.Log is a log.LogFunc,
+// and Close must be called to flush buffered entries before exit.
+func NewSink(publisher Publisher, opts ...Option) *Sink {
+	o := defaultOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	sink := &Sink{
+		publisher: publisher,
+		options:   o,
+		entries:   make(chan Message, o.bufferSize),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go sink.run()
+	return sink
+}
+
+var _ log.LogFunc = (&Sink{}).Log
+
+func encodeMessage(level string, message string, fields map[string]interface{}) Message {
+	value, err := json.Marshal(log.Entry{
+		Schema:  SchemaVersion,
+		Level:   level,
+		Time:    time.Now(),
+		Message: message,
+		Fields:  log.SimplifyFields(fields),
+	})
+	if err != nil {
+		value, _ = json.Marshal(log.Entry{
+			Schema:  SchemaVersion,
+			Level:   level,
+			Time:    time.Now(),
+			Message: message,
+			// Not passing through fields which is where the error would have
+			// been
+		})
+	}
+
+	key, _ := fields["trace"].(string)
+	return Message{
+		Key:   key,
+		Value: value,
+		Headers: map[string]string{
+			SchemaVersionHeader: SchemaVersion,
+		},
+	}
+}
+
+// Log queues the entry for publishing. When the buffer is full it blocks
+// until there is space, or drops the entry if WithDropWhenFull is set.
+// Entries logged after Close, or blocked when Close is called, are dropped.
+func (s *Sink) Log(level string, message string, fields map[string]interface{}) {
+	s.inFlight.RLock()
+	defer s.inFlight.RUnlock()
+
+	select {
+	case <-s.closing:
+		s.dropped.Add(1)
+		return
+	default:
+	}
+
+	msg := encodeMessage(level, message, fields)
+
+	if s.options.dropWhenFull {
+		select {
+		case s.entries <- msg:
+		default:
+			s.dropped.Add(1)
+		}
+		return
+	}
+
+	select {
+	case s.entries <- msg:
+	case <-s.closing:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of entries dropped due to a full buffer or a
+// closed sink.
+func (s *Sink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting entries and waits for buffered entries to be
+// published, or for the context to be done.
+func (s *Sink) Close(ctx context.Context) error {
+	alreadyClosed := true
+	s.closeOnce.Do(func() {
+		alreadyClosed = false
+		close(s.closing)
+	})
+	if alreadyClosed {
+		return ErrClosed
+	}
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+
+	// A zero interval disables timed flushes, batches are published when full
+	// or on Close. A nil channel never receives.
+	var tick <-chan time.Time
+	if s.options.flushInterval > 0 {
+		ticker := time.NewTicker(s.options.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	batch := make([]Message, 0, s.options.batchSize)
+	add := func(msg Message) {
+		batch = append(batch, msg)
+		if len(batch) >= s.options.batchSize {
+			s.publish(batch)
+			batch = make([]Message, 0, s.options.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case msg := <-s.entries:
+			add(msg)
+
+		case <-tick:
+			if len(batch) > 0 {
+				s.publish(batch)
+				batch = make([]Message, 0, s.options.batchSize)
+			}
+
+		case <-s.closing:
+			// Wait for Log calls which passed the closing check before Close,
+			// they either send or drop, and later calls see closing
+			s.inFlight.Lock()
+			defer s.inFlight.Unlock()
+
+			// Publish whatever was buffered before Close
+			for {
+				select {
+				case msg := <-s.entries:
+					add(msg)
+				default:
+					s.publish(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sink) publish(batch []Message) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.publishTimeout)
+	defer cancel()
+	if err := s.publisher.Publish(ctx, batch); err != nil {
+		s.options.onError(err)
+	}
+}
@@ -0,0 +1,165 @@
+package bus_log
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+type capturePublisher struct {
+	sync.Mutex
+	batches [][]Message
+	block   chan struct{}
+}
+
+func (cp *capturePublisher) Publish(ctx context.Context, messages []Message) error {
+	if cp.block != nil {
+		<-cp.block
+	}
+	cp.Lock()
+	defer cp.Unlock()
+	cp.batches = append(cp.batches, messages)
+	return nil
+}
+
+func TestSinkBatches(t *testing.T) {
+	publisher := &capturePublisher{}
+	sink := NewSink(publisher, WithBatchSize(2), WithFlushInterval(time.Hour))
+
+	sink.Log("INFO", "one", map[string]interface{}{"trace": "abc"})
+	sink.Log("INFO", "two", map[string]interface{}{})
+	sink.Log("INFO", "three", map[string]interface{}{})
+
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if len(publisher.batches) != 2 {
+		t.Fatalf("want 2 batches, got %d", len(publisher.batches))
+	}
+	if len(publisher.batches[0]) != 2 || len(publisher.batches[1]) != 1 {
+		t.Errorf("unexpected batch sizes %d, %d", len(publisher.batches[0]), len(publisher.batches[1]))
+	}
+
+	first := publisher.batches[0][0]
+	if first.Key != "abc" {
+		t.Errorf("want key abc, got %q", first.Key)
+	}
+	if first.Headers[SchemaVersionHeader] != SchemaVersion {
+		t.Errorf("want schema header %s, got %q", SchemaVersion, first.Headers[SchemaVersionHeader])
+	}
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(first.Value, &decoded); err != nil {
+		t.Fatalf("decoding message: %s", err)
+	}
+	if decoded["message"] != "one" || decoded["level"] != "INFO" {
+		t.Errorf("bad message: %s", string(first.Value))
+	}
+}
+
+func TestSinkDropWhenFull(t *testing.T) {
+	publisher := &capturePublisher{
+		block: make(chan struct{}),
+	}
+	sink := NewSink(publisher, WithBatchSize(1), WithBufferSize(1), WithDropWhenFull())
+
+	// The first entry is taken by the publisher which blocks, the second
+	// fills the buffer, the rest are dropped.
+	for i := 0; i < 5; i++ {
+		sink.Log("INFO", "entry", map[string]interface{}{})
+		time.Sleep(time.Millisecond)
+	}
+
+	if sink.Dropped() == 0 {
+		t.Errorf("want dropped entries")
+	}
+
+	close(publisher.block)
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	sink.Log("INFO", "after close", map[string]interface{}{})
+}
+
+func TestSinkCloseStalledPublisher(t *testing.T) {
+	publisher := &capturePublisher{
+		block: make(chan struct{}),
+	}
+	defer close(publisher.block)
+	sink := NewSink(publisher, WithBatchSize(1), WithBufferSize(1), WithFlushInterval(0))
+
+	// The first entry is taken by the stalled publisher, the second fills
+	// the buffer, the third blocks in Log.
+	sink.Log("INFO", "published", map[string]interface{}{})
+	time.Sleep(time.Millisecond)
+	sink.Log("INFO", "buffered", map[string]interface{}{})
+	logged := make(chan struct{})
+	go func() {
+		sink.Log("INFO", "blocked", map[string]interface{}{})
+		close(logged)
+	}()
+	time.Sleep(time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sink.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Close did not respect the context deadline")
+	}
+
+	select {
+	case <-logged:
+	case <-time.After(time.Second):
+		t.Fatalf("blocked Log was not released by Close")
+	}
+	if sink.Dropped() != 1 {
+		t.Errorf("want the blocked entry dropped, got %d", sink.Dropped())
+	}
+	if err := sink.Close(context.Background()); err != ErrClosed {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestSinkCloseAccountsForEveryEntry(t *testing.T) {
+	for _, dropWhenFull := range []bool{false, true} {
+		opts := []Option{WithBatchSize(10), WithBufferSize(5)}
+		if dropWhenFull {
+			opts = append(opts, WithDropWhenFull())
+		}
+		publisher := &capturePublisher{}
+		sink := NewSink(publisher, opts...)
+
+		const loggers, perLogger = 8, 50
+		var wg sync.WaitGroup
+		for i := 0; i < loggers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < perLogger; j++ {
+					sink.Log("INFO", "entry", map[string]interface{}{})
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		if err := sink.Close(context.Background()); err != nil {
+			t.Fatalf("close: %s", err)
+		}
+		wg.Wait()
+
+		published := 0
+		for _, batch := range publisher.batches {
+			published += len(batch)
+		}
+		// Every entry is either published or counted as dropped, none are
+		// left in the buffer after Close
+		if total := int64(published) + sink.Dropped(); total != loggers*perLogger {
+			t.Errorf("dropWhenFull=%v: want %d entries accounted for, got %d published and %d dropped",
+				dropWhenFull, loggers*perLogger, published, sink.Dropped())
+		}
+	}
+}
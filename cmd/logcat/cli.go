@@ -2,31 +2,116 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pentops/log.go/internal/pretty"
 )
 
 func main() {
+	latency := flag.Bool("latency", false, "show a live table of per-method latency from gRPC and HTTP completion entries")
+	refresh := flag.Duration("refresh", time.Second, "refresh interval for --latency")
+	replay := flag.Bool("replay", false, "re-emit a captured log (the file argument, or stdin) paced by the entry timestamps")
+	speed := flag.String("speed", "1x", "playback speed for --replay, e.g. 2x")
+	format := flag.String("format", "pretty", "output format for --replay, pretty or json")
+	skip := flag.String("skip", "", "comma separated fields to leave out of pretty output")
+	separator := flag.String("separator", "", "line printed before each pretty entry, empty for none")
+	compact := flag.Bool("compact", false, "print each pretty entry on a single line")
+	timestamps := flag.Bool("timestamps", false, "print the time of each pretty entry")
+	noDiff := flag.Bool("no-diff", false, "print every pretty entry in full rather than only the fields which changed")
+	flag.Parse()
+
+	printerOptions := []func(*pretty.Printer){}
+	if *skip != "" {
+		printerOptions = append(printerOptions, pretty.WithSkipFields(strings.Split(*skip, ",")...))
+	}
+	flag.Visit(func(f *flag.Flag) {
+		// The default separator is kept unless the flag is given, even as ""
+		if f.Name == "separator" {
+			printerOptions = append(printerOptions, pretty.WithSeparator(*separator))
+		}
+	})
+	if *compact {
+		printerOptions = append(printerOptions, pretty.WithCompact())
+	}
+	if *timestamps {
+		printerOptions = append(printerOptions, pretty.WithTimestamps())
+	}
+	if *noDiff {
+		printerOptions = append(printerOptions, pretty.WithoutDiff())
+	}
+
+	if err := run(*latency, *refresh, *replay, *speed, *format, printerOptions, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "logcat: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(latency bool, refresh time.Duration, replay bool, speed string, format string, printerOptions []func(*pretty.Printer), args []string) error {
+	if latency {
+		if refresh <= 0 {
+			return fmt.Errorf("refresh must be positive, got %s", refresh)
+		}
+		return runLatency(os.Stdin, os.Stdout, refresh)
+	}
+
+	if replay {
+		multiplier, err := parseSpeed(speed)
+		if err != nil {
+			return err
+		}
+
+		var input io.Reader = os.Stdin
+		if len(args) > 0 {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close() // nolint: errcheck
+			input = file
+		}
+
+		switch format {
+		case "pretty":
+			printer := pretty.NewPrinter(os.Stdout, printerOptions...)
+			return runReplay(input, multiplier, func(line string) {
+				printLine(printer, line)
+			})
+		case "json":
+			return runReplay(input, multiplier, func(line string) {
+				fmt.Fprintln(os.Stdout, line)
+			})
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+	}
+
 	fmt.Printf("LogCat Begin\n")
 
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Split(bufio.ScanLines)
 
-	printer := pretty.NewPrinter(os.Stdout)
+	printer := pretty.NewPrinter(os.Stdout, printerOptions...)
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		if len(line) < 1 {
 			continue
 		}
-		before, after, found := strings.Cut(line, " | ")
-		if !found {
-			after = before
-			before = ""
-		}
-		printer.PrintRawLine(before, after)
+		printLine(printer, line)
+	}
+	return nil
+}
+
+func printLine(printer *pretty.Printer, line string) {
+	before, after, found := strings.Cut(line, " | ")
+	if !found {
+		after = before
+		before = ""
 	}
+	printer.PrintRawLine(before, after)
 }
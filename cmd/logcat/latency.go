@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxLatencySamples bounds the durations kept per method, percentiles are
+// over the most recent samples.
+const maxLatencySamples = 2048
+
+// maxLatencyRows bounds the rows in the table, completions for further keys,
+// e.g. paths with IDs which collapsePath doesn't recognize, share otherRow
+const maxLatencyRows = 500
+
+const otherRow = "(other)"
+
+type methodStats struct {
+	count   int
+	errors  int
+	samples []latencySample
+	next    int
+}
+
+// latencySample is one duration, weighted by the number of completions it
+// stands for when the interceptor sampled completion entries.
+type latencySample struct {
+	seconds float64
+	weight  int
+}
+
+func (ms *methodStats) add(c completion) {
+	// Skipped completions are counted per outcome, so an error's weight is
+	// all errors
+	ms.count += c.weight
+	if c.isError {
+		ms.errors += c.weight
+	}
+	sample := latencySample{seconds: c.durationSeconds, weight: c.weight}
+	if len(ms.samples) < maxLatencySamples {
+		ms.samples = append(ms.samples, sample)
+		return
+	}
+	ms.samples[ms.next] = sample
+	ms.next = (ms.next + 1) % maxLatencySamples
+}
+
+// percentile returns the duration below which p of the total weight of the
+// samples falls. The samples must be sorted by duration.
+func percentile(sorted []latencySample, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	total := 0
+	for _, sample := range sorted {
+		total += sample.weight
+	}
+	target := p * float64(total)
+	cumulative := 0
+	for _, sample := range sorted {
+		cumulative += sample.weight
+		if float64(cumulative) >= target {
+			return sample.seconds
+		}
+	}
+	return sorted[len(sorted)-1].seconds
+}
+
+// completion is the part of a grpc_log or http_log completion entry used for
+// the latency table.
+type completion struct {
+	key             string
+	durationSeconds float64
+	isError         bool
+	// weight is the sampleCount of a sampled entry, otherwise 1
+	weight int
+}
+
+// parseCompletion recognizes handler completion entries by their fields:
+// method and durationSeconds (or durationMS), and code (gRPC) or status
+// (HTTP). Sampled entries are weighted by their sampleCount.
+func parseCompletion(line string) (completion, bool) {
+	if _, after, found := strings.Cut(line, " | "); found {
+		line = after
+	}
+	if !strings.HasPrefix(line, "{") {
+		return completion{}, false
+	}
+
+	entry := struct {
+		Fields map[string]interface{} `json:"fields"`
+	}{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return completion{}, false
+	}
+	fields := entry.Fields
+
+	method, ok := fields["method"].(string)
+	if !ok {
+		return completion{}, false
+	}
+
+	var duration float64
+	if seconds, ok := fields["durationSeconds"].(float64); ok {
+		duration = seconds
+	} else if ms, ok := fields["durationMS"].(float64); ok {
+		duration = ms / 1000
+	} else {
+		return completion{}, false
+	}
+
+	weight := 1
+	if count, ok := fields["sampleCount"].(float64); ok && count >= 1 {
+		weight = int(count)
+	}
+
+	if code, ok := fields["code"].(string); ok {
+		return completion{
+			key:             method,
+			durationSeconds: duration,
+			isError:         code != "OK",
+			weight:          weight,
+		}, true
+	}
+
+	if status, ok := fields["status"].(float64); ok {
+		key := method
+		if path, ok := fields["path"].(string); ok {
+			key = method + " " + collapsePath(path)
+		}
+		return completion{
+			key:             key,
+			durationSeconds: duration,
+			isError:         status >= 500,
+			weight:          weight,
+		}, true
+	}
+
+	return completion{}, false
+}
+
+var (
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numSegment  = regexp.MustCompile(`^[0-9]+$`)
+	hexSegment  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// collapsePath replaces path segments which look like IDs with :id, so that
+// e.g. /users/123 and /users/456 share a row
+func collapsePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if uuidSegment.MatchString(segment) || numSegment.MatchString(segment) || hexSegment.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// runLatency reads entries from input, printing a table of per-method latency
+// every refresh interval, and once more at the end of input.
+func runLatency(input io.Reader, output io.Writer, refresh time.Duration) error {
+	completions := make(chan completion)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(input)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if c, ok := parseCompletion(scanner.Text()); ok {
+				completions <- c
+			}
+		}
+		scanErr <- scanner.Err()
+		close(completions)
+	}()
+
+	stats := map[string]*methodStats{}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case c, ok := <-completions:
+			if !ok {
+				printLatencyTable(output, stats, false)
+				return <-scanErr
+			}
+			key := c.key
+			if _, exists := stats[key]; !exists && len(stats) >= maxLatencyRows {
+				key = otherRow
+			}
+			ms, exists := stats[key]
+			if !exists {
+				ms = &methodStats{}
+				stats[key] = ms
+			}
+			ms.add(c)
+
+		case <-ticker.C:
+			printLatencyTable(output, stats, true)
+		}
+	}
+}
+
+func printLatencyTable(output io.Writer, stats map[string]*methodStats, clear bool) {
+	if clear {
+		// Home the cursor and clear the screen
+		fmt.Fprint(output, "\033[H\033[2J")
+	}
+
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if stats[keys[i]].count != stats[keys[j]].count {
+			return stats[keys[i]].count > stats[keys[j]].count
+		}
+		return keys[i] < keys[j]
+	})
+
+	tw := tabwriter.NewWriter(output, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "COUNT\tERR%%\tP50\tP95\tP99\t  METHOD\n")
+	for _, key := range keys {
+		ms := stats[key]
+		sorted := append([]latencySample{}, ms.samples...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].seconds < sorted[j].seconds
+		})
+		fmt.Fprintf(tw, "%d\t%.1f\t%s\t%s\t%s\t  %s\n",
+			ms.count,
+			100*float64(ms.errors)/float64(ms.count),
+			formatSeconds(percentile(sorted, 0.50)),
+			formatSeconds(percentile(sorted, 0.95)),
+			formatSeconds(percentile(sorted, 0.99)),
+			key,
+		)
+	}
+	tw.Flush() // nolint: errcheck
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond).String()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCompletion(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		line   string
+		want   completion
+		wantOK bool
+	}{{
+		name:   "GRPC",
+		line:   `{"fields":{"method":"/s/M","durationSeconds":0.5,"code":"OK"}}`,
+		want:   completion{key: "/s/M", durationSeconds: 0.5, weight: 1},
+		wantOK: true,
+	}, {
+		name:   "GRPCError",
+		line:   `app | {"fields":{"method":"/s/M","durationSeconds":0.5,"code":"Internal"}}`,
+		want:   completion{key: "/s/M", durationSeconds: 0.5, isError: true, weight: 1},
+		wantOK: true,
+	}, {
+		name:   "HTTP",
+		line:   `{"fields":{"method":"GET","path":"/a","durationMS":250,"status":503}}`,
+		want:   completion{key: "GET /a", durationSeconds: 0.25, isError: true, weight: 1},
+		wantOK: true,
+	}, {
+		name:   "Sampled",
+		line:   `{"fields":{"method":"/s/M","durationSeconds":0.5,"code":"OK","sampled":true,"sampleRate":0.1,"sampleCount":10}}`,
+		want:   completion{key: "/s/M", durationSeconds: 0.5, weight: 10},
+		wantOK: true,
+	}, {
+		name: "NoDuration",
+		line: `{"fields":{"method":"/s/M","code":"OK"}}`,
+	}, {
+		name: "NoOutcome",
+		line: `{"fields":{"method":"/s/M","durationSeconds":0.5}}`,
+	}, {
+		name: "NotJSON",
+		line: `GRPC Handler Complete`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseCompletion(tc.line)
+			if ok != tc.wantOK {
+				t.Fatalf("want ok %v, got %v", tc.wantOK, ok)
+			}
+			if got != tc.want {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	even := []latencySample{{1, 1}, {2, 1}, {3, 1}, {4, 1}}
+	weighted := []latencySample{{1, 9}, {10, 1}}
+
+	for _, tc := range []struct {
+		name    string
+		samples []latencySample
+		p       float64
+		want    float64
+	}{
+		{"Empty", nil, 0.5, 0},
+		{"Min", even, 0, 1},
+		{"Median", even, 0.5, 2},
+		{"Upper", even, 0.75, 3},
+		{"Max", even, 1, 4},
+		{"WeightedMedian", weighted, 0.5, 1},
+		{"WeightedP90", weighted, 0.9, 1},
+		{"WeightedP95", weighted, 0.95, 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := percentile(tc.samples, tc.p); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMethodStatsWeight(t *testing.T) {
+	ms := &methodStats{}
+	ms.add(completion{durationSeconds: 1, weight: 10})
+	ms.add(completion{durationSeconds: 2, isError: true, weight: 5})
+
+	if ms.count != 15 {
+		t.Errorf("want count 15, got %d", ms.count)
+	}
+	if ms.errors != 5 {
+		t.Errorf("want 5 errors, got %d", ms.errors)
+	}
+	if ms.samples[1].weight != 5 {
+		t.Errorf("want error sample weight 5, got %d", ms.samples[1].weight)
+	}
+}
+
+func TestCollapsePath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":                    "/",
+		"/users":               "/users",
+		"/users/123":           "/users/:id",
+		"/users/123/posts/456": "/users/:id/posts/:id",
+		"/orders/0b5e2d4c-6d8e-4c59-9a0b-0c6f8f7d2b1a": "/orders/:id",
+		"/blobs/0123456789abcdef0123":                  "/blobs/:id",
+		"/v2/items":                                    "/v2/items",
+		"/users/abc":                                   "/users/abc",
+	} {
+		if got := collapsePath(path); got != want {
+			t.Errorf("%s: want %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestRunLatencyRowsBounded(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < maxLatencyRows+50; i++ {
+		fmt.Fprintf(&input, `{"fields":{"method":"GET","path":"/users/u%d","durationSeconds":0.1,"status":200}}`+"\n", i)
+	}
+	out := &strings.Builder{}
+	if err := runLatency(strings.NewReader(input.String()), out, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// header plus one line per row
+	if rows := strings.Count(out.String(), "\n") - 1; rows != maxLatencyRows+1 {
+		t.Errorf("want %d rows including %s, got %d", maxLatencyRows+1, otherRow, rows)
+	}
+	if !strings.Contains(out.String(), otherRow) {
+		t.Errorf("want an %s row", otherRow)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSpeed accepts a multiplier with or without a trailing x, e.g. 2x, 0.5
+func parseSpeed(speed string) (float64, error) {
+	multiplier, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(speed), "x"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed %q", speed)
+	}
+	if multiplier <= 0 {
+		return 0, fmt.Errorf("speed must be positive, got %q", speed)
+	}
+	return multiplier, nil
+}
+
+// entryTime returns the time field of a JSON log line, which may have a
+// 'name | ' prefix
+func entryTime(line string) (time.Time, bool) {
+	if _, after, found := strings.Cut(line, " | "); found {
+		line = after
+	}
+	if !strings.HasPrefix(line, "{") {
+		return time.Time{}, false
+	}
+	entry := struct {
+		Time time.Time `json:"time"`
+	}{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return entry.Time, true
+}
+
+// runReplay emits each line of input, waiting between lines for the gap
+// between their entry times divided by speed. Lines without a time are
+// emitted immediately.
+func runReplay(input io.Reader, speed float64, emit func(line string)) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var lastTime time.Time
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 1 {
+			continue
+		}
+
+		if t, ok := entryTime(line); ok {
+			if !lastTime.IsZero() && t.After(lastTime) {
+				time.Sleep(time.Duration(float64(t.Sub(lastTime)) / speed))
+			}
+			lastTime = t
+		}
+
+		emit(line)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSpeed(t *testing.T) {
+	for _, tc := range []struct {
+		speed   string
+		want    float64
+		wantErr bool
+	}{
+		{speed: "1x", want: 1},
+		{speed: "2", want: 2},
+		{speed: " 0.5x ", want: 0.5},
+		{speed: "0x", wantErr: true},
+		{speed: "-2", wantErr: true},
+		{speed: "fast", wantErr: true},
+		{speed: "", wantErr: true},
+	} {
+		t.Run(tc.speed, func(t *testing.T) {
+			got, err := parseSpeed(tc.speed)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type emitted struct {
+	lines []string
+	at    []time.Duration
+	start time.Time
+}
+
+func (e *emitted) emit(line string) {
+	e.lines = append(e.lines, line)
+	e.at = append(e.at, time.Since(e.start))
+}
+
+func TestRunReplayPacing(t *testing.T) {
+	input := strings.Join([]string{
+		`{"time":"2024-01-01T00:00:00Z","message":"one"}`,
+		`app | {"time":"2024-01-01T00:00:01Z","message":"two"}`,
+		`{"time":"2024-01-01T00:00:03Z","message":"three"}`,
+	}, "\n")
+
+	// 3s of entries at 100x is 30ms
+	out := &emitted{start: time.Now()}
+	if err := runReplay(strings.NewReader(input), 100, out.emit); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.lines) != 3 || !strings.Contains(out.lines[0], "one") || !strings.Contains(out.lines[2], "three") {
+		t.Fatalf("want lines in input order, got %q", out.lines)
+	}
+	if gap := out.at[1] - out.at[0]; gap < 10*time.Millisecond {
+		t.Errorf("want a 10ms gap for 1s at 100x, got %s", gap)
+	}
+	if gap := out.at[2] - out.at[1]; gap < 20*time.Millisecond {
+		t.Errorf("want a 20ms gap for 2s at 100x, got %s", gap)
+	}
+	if total := out.at[2]; total > time.Second {
+		t.Errorf("replay took %s, want about 30ms", total)
+	}
+}
+
+func TestRunReplayImmediate(t *testing.T) {
+	input := strings.Join([]string{
+		`{"time":"2024-01-01T00:00:10Z","message":"late"}`,
+		`not a log entry`,
+		``,
+		`{"message":"no time"}`,
+		`{"time":"2024-01-01T00:00:00Z","message":"earlier"}`,
+	}, "\n")
+
+	// Any wait at all would be at least 10s
+	out := &emitted{start: time.Now()}
+	if err := runReplay(strings.NewReader(input), 1, out.emit); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`{"time":"2024-01-01T00:00:10Z","message":"late"}`,
+		`not a log entry`,
+		`{"message":"no time"}`,
+		`{"time":"2024-01-01T00:00:00Z","message":"earlier"}`,
+	}
+	if !reflect.DeepEqual(out.lines, want) {
+		t.Errorf("want %q, got %q", want, out.lines)
+	}
+	if total := out.at[len(out.at)-1]; total > time.Second {
+		t.Errorf("want lines without a later time emitted immediately, took %s", total)
+	}
+}
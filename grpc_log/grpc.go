@@ -2,10 +2,12 @@ package grpc_log
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"runtime"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -13,15 +15,26 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
 
 	"github.com/google/uuid"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/logging"
+	"github.com/pentops/log.go/internal/sampling"
 )
 
 type options struct {
 	shouldLogBody alwaysDecider
 	codeFunc      grpc_logging.ErrorToCode
+	bufferBegin   func(context.Context) context.Context
+	bufferFinish  func(context.Context, error) bool
+	sampler       *sampling.Sampler
+	slowThreshold time.Duration
+	maxBodyBytes  int
+	maxBytesField int
+
+	propagatedFields []string
 }
 
 type alwaysDecider func(methodName string) bool
@@ -42,6 +55,80 @@ func WithRequestBody(f alwaysDecider) Option {
 	}
 }
 
+// WithRequestBuffer holds the debug and info entries of each call until it
+// completes, using e.g. log.BufferRequest and log.FinishRequest. The finish
+// function is called with the handler error before the completion entry is
+// logged, and returns true if it wrote the held entries.
+//
+// Calls slower than WithSlowThreshold are passed to finish with an error so
+// the entries are written. A successful call which finish reports as written,
+// e.g. one slower than log.SlowThreshold, counts as slow for sampling, so the
+// completion entry is kept whichever threshold was exceeded.
+func WithRequestBuffer(begin func(context.Context) context.Context, finish func(context.Context, error) bool) Option {
+	return func(o *options) {
+		o.bufferBegin = begin
+		o.bufferFinish = finish
+	}
+}
+
+// WithCompletionSampling logs only the given fraction (0 to 1) of successful
+// completion entries. Logged entries carry sampled, sampleRate and
+// sampleCount, the number of completions of the same method and outcome
+// (error or not) the entry stands for. Calls slower
+// than WithSlowThreshold are always logged, as are errors if alwaysOnError is
+// set.
+func WithCompletionSampling(rate float64, alwaysOnError bool) Option {
+	return func(o *options) {
+		o.sampler = sampling.New(rate, alwaysOnError)
+	}
+}
+
+// WithSlowThreshold sets the duration above which calls are always logged
+// regardless of sampling. Zero, the default, disables the threshold.
+// This is separate from log.SlowThreshold, see WithRequestBuffer for how the
+// two combine.
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowThreshold = threshold
+	}
+}
+
+func (o *options) isSlow(duration time.Duration) bool {
+	return o.slowThreshold > 0 && duration > o.slowThreshold
+}
+
+// finishBuffer ends the request buffer, returning true if the call should be
+// treated as slow, either by WithSlowThreshold or by the buffer itself.
+func (o *options) finishBuffer(ctx context.Context, err error, duration time.Duration) bool {
+	slow := o.isSlow(duration)
+	if o.bufferFinish == nil {
+		return slow
+	}
+	if err == nil && slow {
+		err = fmt.Errorf("slow call, took %s", duration)
+	}
+	flushed := o.bufferFinish(ctx, err)
+	return slow || (flushed && err == nil)
+}
+
+// WithMaxBodyBytes truncates logged request bodies longer than n bytes,
+// marking the number of bytes removed. Zero, the default, logs the full body.
+func WithMaxBodyBytes(n int) Option {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithMaxBytesField replaces bytes fields longer than n bytes in logged
+// request bodies with a <len=N bytes> placeholder, rather than logging the
+// base64 encoded content. Zero, the default, logs bytes fields in full.
+// Messages packed in an Any are elided when their type is registered.
+func WithMaxBytesField(n int) Option {
+	return func(o *options) {
+		o.maxBytesField = n
+	}
+}
+
 var defaultOptions = &options{
 	shouldLogBody: func(string) bool { return true },
 	codeFunc:      grpc_logging.DefaultErrorToCode,
@@ -96,13 +183,18 @@ func UnaryServerInterceptor(
 			traceHeader := traceHeaders[0]
 			newCtx = traceContextProvider.WithTrace(newCtx, traceHeader)
 			newCtx = metadata.AppendToOutgoingContext(newCtx, "x-trace", traceHeader)
+			newCtx = o.restoreFields(newCtx, md, logContextProvider)
+		}
+
+		if o.bufferBegin != nil {
+			newCtx = o.bufferBegin(newCtx)
 		}
 
 		logCtx := logContextProvider.WithFields(newCtx, nil)
 
 		if o.shouldLogBody(info.FullMethod) {
 			subContext := logContextProvider.WithFields(logCtx, map[string]interface{}{
-				"requestBody": logBody(req),
+				"requestBody": o.logBody(req),
 			})
 			logger.Info(subContext, "GRPC Handler Begin")
 		} else {
@@ -121,8 +213,16 @@ func UnaryServerInterceptor(
 			resp, mainError = handler(newCtx, req)
 		}()
 
+		duration := time.Since(startTime)
+		isSlow := o.finishBuffer(newCtx, mainError, duration)
+		sampleFields, keep := o.sampler.Sample(info.FullMethod, mainError != nil, isSlow)
+		if !keep {
+			return resp, mainError
+		}
+
+		logCtx = logContextProvider.WithFields(logCtx, sampleFields)
 		logCtx = logContextProvider.WithFields(logCtx, map[string]interface{}{
-			"durationSeconds": float32(time.Since(startTime).Nanoseconds()/1000) / 1000000,
+			"durationSeconds": float32(duration.Nanoseconds()/1000) / 1000000,
 			"code":            o.codeFunc(mainError),
 		})
 
@@ -138,15 +238,124 @@ func UnaryServerInterceptor(
 	}
 }
 
-func logBody(msg interface{}) string {
-	if p, ok := msg.(proto.Message); ok {
-		msgBytes, err := protojson.Marshal(p)
-		if err != nil {
-			return fmt.Sprintf("Marshal Error: %s", err.Error())
+func (o *options) logBody(msg interface{}) string {
+	p, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("Non proto message of type %T", msg)
+	}
+
+	var placeholders map[string]string
+	if o.maxBytesField > 0 {
+		p = proto.Clone(p)
+		placeholders = map[string]string{}
+		elideBytes(p.ProtoReflect(), o.maxBytesField, placeholders)
+	}
+
+	msgBytes, err := protojson.Marshal(p)
+	if err != nil {
+		return fmt.Sprintf("Marshal Error: %s", err.Error())
+	}
+	body := string(msgBytes)
+	for encoded, placeholder := range placeholders {
+		body = strings.ReplaceAll(body, encoded, placeholder)
+	}
+
+	if o.maxBodyBytes > 0 && len(body) > o.maxBodyBytes {
+		cut := o.maxBodyBytes
+		// Don't split a multi-byte character
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
 		}
-		return string(msgBytes)
+		body = fmt.Sprintf("%s...<truncated %d bytes>", body[:cut], len(body)-cut)
 	}
-	return fmt.Sprintf("Non proto message of type %T", msg)
+	return body
+}
+
+// elideBytes replaces bytes values longer than max with a sentinel value.
+// placeholders maps the JSON encoding of each sentinel to the JSON string
+// which replaces it in the marshaled output.
+func elideBytes(msg protoreflect.Message, max int, placeholders map[string]string) {
+	if anyMsg, ok := msg.Interface().(*anypb.Any); ok {
+		elideAny(anyMsg, max, placeholders)
+		return
+	}
+
+	elide := func(val protoreflect.Value) (protoreflect.Value, bool) {
+		length := len(val.Bytes())
+		if length <= max {
+			return val, false
+		}
+		sentinel := []byte(fmt.Sprintf("\x00\xfflog-elided:%d", length))
+		encoded := fmt.Sprintf("%q", base64.StdEncoding.EncodeToString(sentinel))
+		placeholders[encoded] = fmt.Sprintf(`"<len=%d bytes>"`, length)
+		return protoreflect.ValueOfBytes(sentinel), true
+	}
+
+	isMessage := func(fd protoreflect.FieldDescriptor) bool {
+		return fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+	}
+
+	// Replacements are applied after Range, as setting fields during
+	// iteration is not supported
+	replace := map[protoreflect.FieldDescriptor]protoreflect.Value{}
+	msg.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := val.List()
+			for i := 0; i < list.Len(); i++ {
+				if fd.Kind() == protoreflect.BytesKind {
+					if elided, ok := elide(list.Get(i)); ok {
+						list.Set(i, elided)
+					}
+				} else if isMessage(fd) {
+					elideBytes(list.Get(i).Message(), max, placeholders)
+				}
+			}
+
+		case fd.IsMap():
+			valueFd := fd.MapValue()
+			mapVal := val.Map()
+			mapVal.Range(func(key protoreflect.MapKey, entry protoreflect.Value) bool {
+				if valueFd.Kind() == protoreflect.BytesKind {
+					if elided, ok := elide(entry); ok {
+						mapVal.Set(key, elided)
+					}
+				} else if isMessage(valueFd) {
+					elideBytes(entry.Message(), max, placeholders)
+				}
+				return true
+			})
+
+		case fd.Kind() == protoreflect.BytesKind:
+			if elided, ok := elide(val); ok {
+				replace[fd] = elided
+			}
+
+		case isMessage(fd):
+			elideBytes(val.Message(), max, placeholders)
+		}
+		return true
+	})
+	for fd, val := range replace {
+		msg.Set(fd, val)
+	}
+}
+
+// elideAny elides bytes within the message packed in an Any. The packed value
+// is itself bytes, but protojson has to unpack it to marshal the Any, so it is
+// unpacked, elided and repacked. An Any which can't be unpacked is left as it
+// is.
+func elideAny(anyMsg *anypb.Any, max int, placeholders map[string]string) {
+	inner, err := anyMsg.UnmarshalNew()
+	if err != nil {
+		return
+	}
+	elideBytes(inner.ProtoReflect(), max, placeholders)
+	value, err := proto.Marshal(inner)
+	if err != nil {
+		return
+	}
+	anyMsg.Value = value
 }
 
 func logPanic(ctx context.Context, logContextProvider FieldContext, panicString interface{}, logger Logger) {
@@ -193,6 +402,11 @@ func StreamServerInterceptor(
 			}
 			newCtx = traceContextProvider.WithTrace(newCtx, traceHeader[0])
 			newCtx = metadata.AppendToOutgoingContext(newCtx, "x-trace", traceHeader[0])
+			newCtx = o.restoreFields(newCtx, md, logContextProvider)
+		}
+
+		if o.bufferBegin != nil {
+			newCtx = o.bufferBegin(newCtx)
 		}
 
 		wrapped := grpc_middleware.WrapServerStream(stream)
@@ -200,9 +414,18 @@ func StreamServerInterceptor(
 
 		err := handler(srv, wrapped)
 
-		logCtx := logContextProvider.WithFields(newCtx, map[string]interface{}{
-			"duration": float32(time.Since(startTime).Nanoseconds()/1000) / 1000,
-			"code":     o.codeFunc(err),
+		duration := time.Since(startTime)
+		isSlow := o.finishBuffer(newCtx, err, duration)
+		sampleFields, keep := o.sampler.Sample(info.FullMethod, err != nil, isSlow)
+		if !keep {
+			return err
+		}
+
+		logCtx := logContextProvider.WithFields(newCtx, sampleFields)
+		logCtx = logContextProvider.WithFields(logCtx, map[string]interface{}{
+			"duration":        float32(duration.Nanoseconds()/1000) / 1000,
+			"durationSeconds": float32(duration.Nanoseconds()/1000) / 1000000,
+			"code":            o.codeFunc(err),
 		})
 
 		logger.Info(logCtx, "GRPC Stream Complete")
@@ -0,0 +1,358 @@
+package grpc_log
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestLogBodyBytesField(t *testing.T) {
+	o := evaluateServerOpt([]Option{WithMaxBytesField(10)})
+
+	msg := wrapperspb.Bytes(make([]byte, 100))
+	got := o.logBody(msg)
+	if got != `"<len=100 bytes>"` {
+		t.Errorf("want placeholder, got %s", got)
+	}
+	if len(msg.Value) != 100 {
+		t.Errorf("original message should not be modified")
+	}
+
+	short := o.logBody(wrapperspb.Bytes([]byte("abc")))
+	if short != `"YWJj"` {
+		t.Errorf("want short bytes logged in full, got %s", short)
+	}
+}
+
+// blobDescriptor builds a message with bytes in each position elideBytes
+// walks: a single field, a repeated field, map values and a nested message.
+func blobDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	bytesType := descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+	stringType := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	messageType := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/blob.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Blob"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("single"), JsonName: proto.String("single"), Number: proto.Int32(1), Label: optional, Type: bytesType},
+				{Name: proto.String("list"), JsonName: proto.String("list"), Number: proto.Int32(2), Label: repeated, Type: bytesType},
+				{Name: proto.String("by_key"), JsonName: proto.String("byKey"), Number: proto.Int32(3), Label: repeated, Type: messageType, TypeName: proto.String(".test.Blob.ByKeyEntry")},
+				{Name: proto.String("child"), JsonName: proto.String("child"), Number: proto.Int32(4), Label: optional, Type: messageType, TypeName: proto.String(".test.Blob")},
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("ByKeyEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("key"), JsonName: proto.String("key"), Number: proto.Int32(1), Label: optional, Type: stringType},
+					{Name: proto.String("value"), JsonName: proto.String("value"), Number: proto.Int32(2), Label: optional, Type: bytesType},
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("Blob")
+}
+
+func TestLogBodyBytesFieldPositions(t *testing.T) {
+	o := evaluateServerOpt([]Option{WithMaxBytesField(10)})
+	desc := blobDescriptor(t)
+	fields := desc.Fields()
+	long := protoreflect.ValueOfBytes(make([]byte, 100))
+
+	child := dynamicpb.NewMessage(desc)
+	child.Set(fields.ByName("single"), long)
+
+	msg := dynamicpb.NewMessage(desc)
+	list := msg.Mutable(fields.ByName("list")).List()
+	list.Append(long)
+	list.Append(protoreflect.ValueOfBytes([]byte("abc")))
+	byKey := msg.Mutable(fields.ByName("by_key")).Map()
+	byKey.Set(protoreflect.ValueOfString("k").MapKey(), long)
+	msg.Set(fields.ByName("child"), protoreflect.ValueOfMessage(child))
+
+	got := o.logBody(msg)
+	want := `{"list":["<len=100 bytes>","YWJj"],"byKey":{"k":"<len=100 bytes>"},"child":{"single":"<len=100 bytes>"}}`
+	// protojson randomly adds spaces between fields
+	if strings.ReplaceAll(got, " ", "") != strings.ReplaceAll(want, " ", "") {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestLogBodyBytesFieldAny(t *testing.T) {
+	o := evaluateServerOpt([]Option{WithMaxBytesField(10)})
+
+	packedBytes, err := anypb.New(wrapperspb.Bytes(make([]byte, 50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := o.logBody(packedBytes)
+	want := `{"@type":"type.googleapis.com/google.protobuf.BytesValue","value":"<len=50 bytes>"}`
+	// protojson randomly adds spaces between fields
+	if strings.ReplaceAll(got, " ", "") != strings.ReplaceAll(want, " ", "") {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if len(packedBytes.Value) < 50 {
+		t.Errorf("original message should not be modified")
+	}
+
+	packedString, err := anypb.New(wrapperspb.String(strings.Repeat("a", 50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = o.logBody(&typepb.Option{Name: "nested", Value: packedString})
+	if !strings.Contains(got, strings.Repeat("a", 50)) {
+		t.Errorf("want nested Any logged in full, got %s", got)
+	}
+}
+
+func TestLogBodyMaxBytes(t *testing.T) {
+	o := evaluateServerOpt([]Option{WithMaxBodyBytes(20)})
+
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"key": strings.Repeat("a", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := o.logBody(msg)
+	prefix, marker, found := strings.Cut(got, "...<truncated ")
+	if !found {
+		t.Fatalf("want truncation marker, got %s", got)
+	}
+	if len(prefix) != 20 {
+		t.Errorf("want 20 bytes before the marker, got %d", len(prefix))
+	}
+	if !strings.HasSuffix(marker, " bytes>") {
+		t.Errorf("bad marker %s", marker)
+	}
+}
+
+type mapFields struct{}
+
+type mapFieldsKey struct{}
+
+func (mf mapFields) WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	merged := map[string]interface{}{}
+	for k, v := range mf.LogFieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, mapFieldsKey{}, merged)
+}
+
+func (mapFields) LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+	fields, _ := ctx.Value(mapFieldsKey{}).(map[string]interface{})
+	return fields
+}
+
+func TestPropagatedFields(t *testing.T) {
+	o := evaluateServerOpt([]Option{WithPropagatedFields("tenant", "actor")})
+
+	clientCtx := mapFields{}.WithFields(context.Background(), map[string]interface{}{
+		"tenant": "t1",
+		"actor":  "a&b=c",
+		"secret": "not sent",
+	})
+	clientCtx = o.propagateFields(clientCtx, mapFields{})
+
+	outgoing, _ := metadata.FromOutgoingContext(clientCtx)
+	// a client sending fields outside the allowlist
+	outgoing.Append(propagatedFieldsHeader, "admin=true")
+
+	serverCtx := o.restoreFields(context.Background(), outgoing, mapFields{})
+	got := mapFields{}.LogFieldsFromContext(serverCtx)
+
+	if got["tenant"] != "t1" || got["actor"] != "a&b=c" {
+		t.Errorf("want propagated fields restored, got %v", got)
+	}
+	if _, ok := got["secret"]; ok {
+		t.Errorf("fields outside the allowlist should not be sent")
+	}
+	if _, ok := got["admin"]; ok {
+		t.Errorf("fields outside the allowlist should not be restored")
+	}
+}
+
+type noTrace struct{}
+
+func (noTrace) WithTrace(ctx context.Context, _ string) context.Context {
+	return ctx
+}
+
+type messageLogger struct {
+	messages []string
+	fields   []map[string]interface{}
+}
+
+func (ml *messageLogger) log(ctx context.Context, msg string) {
+	ml.messages = append(ml.messages, msg)
+	ml.fields = append(ml.fields, mapFields{}.LogFieldsFromContext(ctx))
+}
+
+func (ml *messageLogger) Info(ctx context.Context, msg string)  { ml.log(ctx, msg) }
+func (ml *messageLogger) Error(ctx context.Context, msg string) { ml.log(ctx, msg) }
+func (ml *messageLogger) Debug(ctx context.Context, msg string) { ml.log(ctx, msg) }
+
+func TestUnaryCompletionSampling(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	ok := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	fail := func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("failed") }
+	slow := func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	}
+
+	for _, tc := range []struct {
+		name         string
+		options      []Option
+		handler      grpc.UnaryHandler
+		wantComplete bool
+	}{{
+		name:         "SuccessDropped",
+		options:      []Option{WithCompletionSampling(0, true)},
+		handler:      ok,
+		wantComplete: false,
+	}, {
+		name:         "SuccessKept",
+		options:      []Option{WithCompletionSampling(1, true)},
+		handler:      ok,
+		wantComplete: true,
+	}, {
+		name:         "ErrorKept",
+		options:      []Option{WithCompletionSampling(0, true)},
+		handler:      fail,
+		wantComplete: true,
+	}, {
+		name:         "ErrorDropped",
+		options:      []Option{WithCompletionSampling(0, false)},
+		handler:      fail,
+		wantComplete: false,
+	}, {
+		name:         "SlowKept",
+		options:      []Option{WithCompletionSampling(0, false), WithSlowThreshold(time.Millisecond)},
+		handler:      slow,
+		wantComplete: true,
+	}, {
+		name: "BufferFlushKept",
+		options: []Option{
+			WithCompletionSampling(0, false),
+			WithRequestBuffer(
+				func(ctx context.Context) context.Context { return ctx },
+				func(context.Context, error) bool { return true },
+			),
+		},
+		handler:      ok,
+		wantComplete: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &messageLogger{}
+			interceptor := UnaryServerInterceptor(mapFields{}, noTrace{}, logger, tc.options...)
+			_, _ = interceptor(context.Background(), nil, info, tc.handler)
+
+			gotComplete := false
+			for _, msg := range logger.messages {
+				if msg == "GRPC Handler Complete" {
+					gotComplete = true
+				}
+			}
+			if gotComplete != tc.wantComplete {
+				t.Errorf("want completion logged %v, got messages %v", tc.wantComplete, logger.messages)
+			}
+		})
+	}
+}
+
+func TestUnarySlowFlushesBuffer(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	var finishErr error
+	interceptor := UnaryServerInterceptor(mapFields{}, noTrace{}, &messageLogger{},
+		WithSlowThreshold(time.Millisecond),
+		WithRequestBuffer(
+			func(ctx context.Context) context.Context { return ctx },
+			func(_ context.Context, err error) bool {
+				finishErr = err
+				return err != nil
+			},
+		),
+	)
+	_, _ = interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	})
+	if finishErr == nil {
+		t.Error("want a slow call passed to finish with an error")
+	}
+}
+
+func TestUnarySampleCountPerMethod(t *testing.T) {
+	logger := &messageLogger{}
+	interceptor := UnaryServerInterceptor(mapFields{}, noTrace{}, logger, WithCompletionSampling(0.5, false))
+	ok := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	fail := func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("failed") }
+
+	type outcome struct {
+		method  string
+		isError bool
+	}
+	// Sampling is random, so the expected count for each kept entry is
+	// tracked from which calls were logged
+	skipped := map[outcome]int64{}
+	kept := 0
+	for i := 0; i < 300; i++ {
+		call := outcome{method: "/test.Service/A"}
+		handler := ok
+		switch i % 3 {
+		case 1:
+			call.method = "/test.Service/B"
+		case 2:
+			call.isError = true
+			handler = fail
+		}
+
+		logger.messages, logger.fields = nil, nil
+		info := &grpc.UnaryServerInfo{FullMethod: call.method}
+		_, _ = interceptor(context.Background(), nil, info, handler)
+
+		last := len(logger.messages) - 1
+		if logger.messages[last] != "GRPC Handler Complete" {
+			skipped[call]++
+			continue
+		}
+		kept++
+		want := skipped[call] + 1
+		skipped[call] = 0
+		if got := logger.fields[last]["sampleCount"]; got != want {
+			t.Errorf("call %d %v: want sampleCount %d, got %v", i, call, want, got)
+		}
+	}
+	if kept == 0 || kept == 300 {
+		t.Errorf("want some calls sampled, kept %d of 300", kept)
+	}
+}
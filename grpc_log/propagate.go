@@ -0,0 +1,106 @@
+package grpc_log
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// propagatedFieldsHeader carries the allowlisted log fields between services,
+// URL query encoded to keep the metadata value ASCII.
+const propagatedFieldsHeader = "x-log-fields"
+
+// maxPropagatedValueLength limits the size of each propagated value, longer
+// values are not sent.
+const maxPropagatedValueLength = 256
+
+// WithPropagatedFields sets the log fields which are carried between services
+// in gRPC metadata. Client interceptors send these fields from the outgoing
+// context, server interceptors restore them into the log context. Only the
+// listed keys are restored, anything else a client sends is ignored. Values
+// are sent as strings.
+func WithPropagatedFields(keys ...string) Option {
+	return func(o *options) {
+		o.propagatedFields = append(o.propagatedFields, keys...)
+	}
+}
+
+type FieldSource interface {
+	LogFieldsFromContext(context.Context) map[string]interface{}
+}
+
+// UnaryClientInterceptor sends the log fields set by WithPropagatedFields to
+// the server.
+func UnaryClientInterceptor(
+	logContextProvider FieldSource,
+	options ...Option,
+) grpc.UnaryClientInterceptor {
+	o := evaluateServerOpt(options)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = o.propagateFields(ctx, logContextProvider)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the log fields set by WithPropagatedFields to
+// the server.
+func StreamClientInterceptor(
+	logContextProvider FieldSource,
+	options ...Option,
+) grpc.StreamClientInterceptor {
+	o := evaluateServerOpt(options)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = o.propagateFields(ctx, logContextProvider)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func (o *options) propagateFields(ctx context.Context, logContextProvider FieldSource) context.Context {
+	if len(o.propagatedFields) == 0 {
+		return ctx
+	}
+
+	fields := logContextProvider.LogFieldsFromContext(ctx)
+	values := url.Values{}
+	for _, key := range o.propagatedFields {
+		val, ok := fields[key]
+		if !ok || val == nil {
+			continue
+		}
+		str := fmt.Sprint(val)
+		if len(str) > maxPropagatedValueLength {
+			continue
+		}
+		values.Set(key, str)
+	}
+	if len(values) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, propagatedFieldsHeader, values.Encode())
+}
+
+func (o *options) restoreFields(ctx context.Context, md metadata.MD, logContextProvider FieldContext) context.Context {
+	if len(o.propagatedFields) == 0 {
+		return ctx
+	}
+
+	fields := map[string]interface{}{}
+	for _, header := range md.Get(propagatedFieldsHeader) {
+		values, err := url.ParseQuery(header)
+		if err != nil {
+			continue
+		}
+		for _, key := range o.propagatedFields {
+			if val := values.Get(key); val != "" && len(val) <= maxPropagatedValueLength {
+				fields[key] = val
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return ctx
+	}
+	return logContextProvider.WithFields(ctx, fields)
+}
@@ -2,12 +2,68 @@ package http_log
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pentops/log.go/internal/sampling"
 )
 
+type options struct {
+	bufferBegin   func(context.Context) context.Context
+	bufferFinish  func(context.Context, error) bool
+	sampler       *sampling.Sampler
+	slowThreshold time.Duration
+}
+
+type Option func(*options)
+
+// WithRequestBuffer holds the debug and info entries of each request until it
+// completes, using e.g. log.BufferRequest and log.FinishRequest. The finish
+// function is called before the response entry is logged, with an error for
+// 5xx responses and requests slower than WithSlowThreshold, and returns true
+// if it wrote the held entries. A non-5xx request which finish reports as
+// written, e.g. one slower than log.SlowThreshold, counts as slow for
+// sampling, so the response entry is kept whichever threshold was exceeded.
+func WithRequestBuffer(begin func(context.Context) context.Context, finish func(context.Context, error) bool) Option {
+	return func(o *options) {
+		o.bufferBegin = begin
+		o.bufferFinish = finish
+	}
+}
+
+// WithCompletionSampling logs only the given fraction (0 to 1) of successful
+// response entries. Logged entries carry sampled, sampleRate and sampleCount,
+// the number of responses with the same HTTP method and outcome (5xx or not)
+// the entry stands for. Requests are counted by method rather than path, as
+// paths often hold IDs. Requests slower than
+// WithSlowThreshold are always logged, as are 5xx responses if alwaysOnError
+// is set.
+func WithCompletionSampling(rate float64, alwaysOnError bool) Option {
+	return func(o *options) {
+		o.sampler = sampling.New(rate, alwaysOnError)
+	}
+}
+
+// WithSlowThreshold sets the duration above which requests are always logged
+// regardless of sampling. Zero, the default, disables the threshold.
+// This is separate from log.SlowThreshold, see WithRequestBuffer for how the
+// two combine.
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowThreshold = threshold
+	}
+}
+
+func evaluateOpt(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 type FieldContext interface {
 	WithFields(context.Context, map[string]interface{}) context.Context
 }
@@ -24,7 +80,9 @@ func Middleware(
 	logContextProvider FieldContext,
 	traceContextProvider TraceContext,
 	logger Logger,
+	options ...Option,
 ) func(http.Handler) http.Handler {
+	o := evaluateOpt(options)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 
@@ -46,6 +104,9 @@ func Middleware(
 				"protocol": req.Proto,
 				"trace":    trace,
 			})
+			if o.bufferBegin != nil {
+				ctx = o.bufferBegin(ctx)
+			}
 			req = req.WithContext(ctx)
 			logger.Info(ctx, "Request")
 			begin := time.Now()
@@ -54,12 +115,34 @@ func Middleware(
 				status:         http.StatusOK,
 			}
 			next.ServeHTTP(ss, req)
+			duration := time.Since(begin)
+			isError := ss.status >= http.StatusInternalServerError
+			isSlow := o.slowThreshold > 0 && duration > o.slowThreshold
+			if o.bufferFinish != nil {
+				var statusErr error
+				if isError {
+					statusErr = fmt.Errorf("HTTP status %d", ss.status)
+				} else if isSlow {
+					statusErr = fmt.Errorf("slow request, took %s", duration)
+				}
+				if o.bufferFinish(ctx, statusErr) && !isError {
+					isSlow = true
+				}
+			}
+
+			sampleFields, keep := o.sampler.Sample(req.Method, isError, isSlow)
+			if !keep {
+				return
+			}
+
+			ctx = logContextProvider.WithFields(ctx, sampleFields)
 			ctx = logContextProvider.WithFields(ctx, map[string]interface{}{
-				"method":     req.Method,
-				"path":       req.URL.Path,
-				"protocol":   req.Proto,
-				"status":     ss.status,
-				"durationMS": time.Since(begin).Milliseconds(),
+				"method":          req.Method,
+				"path":            req.URL.Path,
+				"protocol":        req.Proto,
+				"status":          ss.status,
+				"durationMS":      duration.Milliseconds(),
+				"durationSeconds": duration.Seconds(),
 			})
 			logger.Info(ctx, "Response")
 		})
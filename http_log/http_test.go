@@ -0,0 +1,99 @@
+package http_log
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type noFields struct{}
+
+func (noFields) WithFields(ctx context.Context, _ map[string]interface{}) context.Context {
+	return ctx
+}
+
+func (noFields) WithTrace(ctx context.Context, _ string) context.Context {
+	return ctx
+}
+
+type messageLogger struct {
+	messages []string
+}
+
+func (ml *messageLogger) Info(_ context.Context, msg string) {
+	ml.messages = append(ml.messages, msg)
+}
+
+func TestResponseSampling(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	fail := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		name         string
+		options      []Option
+		handler      http.Handler
+		wantResponse bool
+	}{{
+		name:         "SuccessDropped",
+		options:      []Option{WithCompletionSampling(0, true)},
+		handler:      ok,
+		wantResponse: false,
+	}, {
+		name:         "SuccessKept",
+		options:      []Option{WithCompletionSampling(1, true)},
+		handler:      ok,
+		wantResponse: true,
+	}, {
+		name:         "ErrorKept",
+		options:      []Option{WithCompletionSampling(0, true)},
+		handler:      fail,
+		wantResponse: true,
+	}, {
+		name:         "ErrorDropped",
+		options:      []Option{WithCompletionSampling(0, false)},
+		handler:      fail,
+		wantResponse: false,
+	}, {
+		name:         "SlowKept",
+		options:      []Option{WithCompletionSampling(0, false), WithSlowThreshold(time.Millisecond)},
+		handler:      slow,
+		wantResponse: true,
+	}, {
+		name: "BufferFlushKept",
+		options: []Option{
+			WithCompletionSampling(0, false),
+			WithRequestBuffer(
+				func(ctx context.Context) context.Context { return ctx },
+				func(context.Context, error) bool { return true },
+			),
+		},
+		handler:      ok,
+		wantResponse: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &messageLogger{}
+			handler := Middleware(noFields{}, noFields{}, logger, tc.options...)(tc.handler)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil))
+
+			gotResponse := false
+			for _, msg := range logger.messages {
+				if msg == "Response" {
+					gotResponse = true
+				}
+			}
+			if gotResponse != tc.wantResponse {
+				t.Errorf("want response logged %v, got messages %v", tc.wantResponse, logger.messages)
+			}
+		})
+	}
+}
@@ -5,62 +5,103 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/fatih/color"
+	"github.com/pentops/log.go/internal/render"
 	"github.com/pentops/log.go/log"
 )
 
-var levelColors = map[string]color.Attribute{
-	"debug": color.FgBlue,
-	"info":  color.FgGreen,
-	"warn":  color.FgYellow,
-	"error": color.FgRed,
-}
-
 type Printer struct {
-	prefix   string
-	output   io.Writer
-	didDots  bool
-	lastLine map[string]interface{}
+	output        io.Writer
+	renderOptions render.Options
+	renderer      *render.Renderer
+	didDots       bool
+	disableDiff   bool
+	// lastLines holds the previous line for each name prefix, so that
+	// interleaved output from several sources is compared per source
+	lastLines map[string]map[string]interface{}
+	// lastPrefix is the name prefix of the most recently printed line
+	lastPrefix string
 }
 
 func WithPrefix(prefix string) func(*Printer) {
 	return func(p *Printer) {
-		p.prefix = prefix
+		p.renderOptions.Prefix = prefix
+	}
+}
+
+// WithSkipFields excludes the fields from printed entries
+func WithSkipFields(fields ...string) func(*Printer) {
+	return func(p *Printer) {
+		if p.renderOptions.SkipFields == nil {
+			p.renderOptions.SkipFields = map[string]struct{}{}
+		}
+		for _, field := range fields {
+			p.renderOptions.SkipFields[field] = struct{}{}
+		}
+	}
+}
+
+// WithSeparator replaces the line printed before each entry, an empty
+// separator prints nothing.
+func WithSeparator(separator string) func(*Printer) {
+	return func(p *Printer) {
+		p.renderOptions.Separator = &separator
+	}
+}
+
+// WithCompact prints each entry on a single line
+func WithCompact() func(*Printer) {
+	return func(p *Printer) {
+		p.renderOptions.Compact = true
+	}
+}
+
+// WithTimestamps prints the time of each entry
+func WithTimestamps() func(*Printer) {
+	return func(p *Printer) {
+		p.renderOptions.Timestamps = true
+	}
+}
+
+// WithoutDiff prints every line in full, rather than printing only the changed
+// fields of a line which is nearly identical to the one before it.
+func WithoutDiff() func(*Printer) {
+	return func(p *Printer) {
+		p.disableDiff = true
 	}
 }
 
 func NewPrinter(output io.Writer, opts ...func(*Printer)) *Printer {
 	pp := &Printer{
-		output: output,
+		output:    output,
+		lastLines: map[string]map[string]interface{}{},
 	}
 
 	for _, opt := range opts {
 		opt(pp)
 	}
 
+	pp.renderer = render.NewRenderer(pp.renderOptions)
+
 	return pp
 }
 
-func (p *Printer) writef(namePrefix, line string, args ...interface{}) {
+func (p *Printer) endDots() {
 	if p.didDots {
 		fmt.Fprintf(p.output, "\n")
 		p.didDots = false
 	}
-	fmt.Fprintf(p.output, "========\n")
+}
+
+func (p *Printer) writef(namePrefix, line string, args ...interface{}) {
+	p.endDots()
 	if len(args) > 0 {
 		line = fmt.Sprintf(line, args...)
 	}
-	if p.prefix != "" {
-		namePrefix = p.prefix + " " + namePrefix
-	}
-
-	if namePrefix != "" {
-		fmt.Fprintf(p.output, "%s: %s\n", namePrefix, line)
-	} else {
-		fmt.Fprintf(p.output, "%s\n", line)
-	}
+	p.renderer.Raw(p.output, namePrefix, line)
 }
 
 func (p *Printer) CallbackWithPrefix(prefix string) log.LogFunc {
@@ -70,23 +111,15 @@ func (p *Printer) CallbackWithPrefix(prefix string) log.LogFunc {
 }
 
 func (p *Printer) PrintStandardLine(namePrefix, level, message string, fields map[string]interface{}) {
-	whichColor, ok := levelColors[strings.ToLower(level)]
-	if !ok {
-		whichColor = color.FgWhite
-	}
-
-	levelColor := color.New(whichColor).SprintFunc()
-	p.writef(namePrefix, "%s: %s", levelColor(level), message)
+	// Not parsed from a raw line, so a following raw line can't repeat it
+	delete(p.lastLines, namePrefix)
+	p.lastPrefix = namePrefix
+	p.printEntry(namePrefix, time.Now(), level, message, fields)
+}
 
-	for k, v := range fields {
-		switch v.(type) {
-		case string, int, int64, int32, float64, bool:
-			fmt.Fprintf(p.output, "| %s: %v\n", k, v)
-		default:
-			nice, _ := json.MarshalIndent(v, "|  ", "  ")
-			fmt.Fprintf(p.output, "| %s: %s\n", k, string(nice))
-		}
-	}
+func (p *Printer) printEntry(namePrefix string, entryTime time.Time, level, message string, fields map[string]interface{}) {
+	p.endDots()
+	p.renderer.Entry(p.output, namePrefix, entryTime, level, message, fields)
 }
 
 type writeBuffer struct {
@@ -123,8 +156,8 @@ func (p *Printer) WriterInterceptor(prefix string) io.Writer {
 func (p *Printer) PrintRawLine(namePrefix, line string) {
 
 	if line[0] != '{' {
-		p.didDots = false
-		p.lastLine = map[string]interface{}{}
+		delete(p.lastLines, namePrefix)
+		p.lastPrefix = namePrefix
 		p.writef(namePrefix, line)
 		return
 	}
@@ -136,26 +169,81 @@ func (p *Printer) PrintRawLine(namePrefix, line string) {
 		return
 	}
 
+	var entryTime time.Time
+	if timeString, ok := fields["time"].(string); ok {
+		entryTime, _ = time.Parse(time.RFC3339Nano, timeString)
+	}
+
 	delete(fields, "time")
+	// The schema version doesn't change between lines of the same process
+	delete(fields, "schema")
 
-	if reflect.DeepEqual(fields, p.lastLine) {
+	lastLine := p.lastLines[namePrefix]
+	// Dots only make sense directly after the line they repeat
+	if namePrefix == p.lastPrefix && reflect.DeepEqual(fields, lastLine) {
 		p.output.Write([]byte(".")) // nolint: errcheck
 		p.didDots = true
 		return
 	}
-	p.lastLine = fields
-	if p.didDots {
-		fmt.Printf("\n")
+	p.lastLines[namePrefix] = fields
+	p.lastPrefix = namePrefix
+
+	level, message, innerFields, isStandard := standardLine(fields)
+	if !isStandard {
+		p.writef(namePrefix, line)
+		return
+	}
+
+	if !p.disableDiff {
+		lastLevel, lastMessage, lastFields, lastIsStandard := standardLine(lastLine)
+		if lastIsStandard && lastLevel == level && lastMessage == message {
+			if changed, removed, ok := diffFields(lastFields, innerFields); ok {
+				p.endDots()
+				p.renderer.Diff(p.output, namePrefix, level, message, changed, removed)
+				return
+			}
+		}
 	}
-	p.didDots = false
 
+	p.printEntry(namePrefix, entryTime, level, message, innerFields)
+}
+
+func standardLine(fields map[string]interface{}) (string, string, map[string]interface{}, bool) {
 	level, hasLevel := fields["level"].(string)
 	message, hasMessage := fields["message"].(string)
 	innerFields, hasFields := fields["fields"].(map[string]interface{})
-
 	if hasLevel && hasMessage && hasFields && len(fields) == 3 {
-		p.PrintStandardLine(namePrefix, level, message, innerFields)
-	} else {
-		p.writef(namePrefix, line)
+		return level, message, innerFields, true
+	}
+	return "", "", nil, false
+}
+
+// maxDiffFields is the most fields which can change between consecutive lines
+// for the second to be printed as a diff of the first.
+const maxDiffFields = 3
+
+// diffFields returns the fields which were added or changed, and the keys of
+// those removed, from last to next. ok is false when the lines are too
+// different to be worth printing as a diff.
+func diffFields(last, next map[string]interface{}) (map[string]interface{}, []string, bool) {
+	changed := map[string]interface{}{}
+	for k, v := range next {
+		lastVal, ok := last[k]
+		if !ok || !reflect.DeepEqual(lastVal, v) {
+			changed[k] = v
+		}
+	}
+	removed := []string{}
+	for k := range last {
+		if _, ok := next[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+
+	diffCount := len(changed) + len(removed)
+	if diffCount > maxDiffFields || diffCount >= len(next) {
+		return nil, nil, false
 	}
+	return changed, removed, true
 }
@@ -0,0 +1,89 @@
+package pretty
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestDiffFields(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		last, next  map[string]interface{}
+		wantChanged map[string]interface{}
+		wantRemoved []string
+		wantOK      bool
+	}{{
+		name:        "OneChanged",
+		last:        map[string]interface{}{"a": 1.0, "b": "x", "c": "y"},
+		next:        map[string]interface{}{"a": 2.0, "b": "x", "c": "y"},
+		wantChanged: map[string]interface{}{"a": 2.0},
+		wantRemoved: []string{},
+		wantOK:      true,
+	}, {
+		name:        "AddedAndRemoved",
+		last:        map[string]interface{}{"a": 1.0, "b": "x", "c": "y", "d": "z"},
+		next:        map[string]interface{}{"a": 1.0, "b": "x", "c": "y", "e": "z"},
+		wantChanged: map[string]interface{}{"e": "z"},
+		wantRemoved: []string{"d"},
+		wantOK:      true,
+	}, {
+		name: "TooManyChanged",
+		last: map[string]interface{}{"a": 1.0, "b": 1.0, "c": 1.0, "d": 1.0, "e": 1.0},
+		next: map[string]interface{}{"a": 2.0, "b": 2.0, "c": 2.0, "d": 2.0, "e": 1.0},
+	}, {
+		name: "AllChanged",
+		last: map[string]interface{}{"a": 1.0, "b": 1.0},
+		next: map[string]interface{}{"a": 2.0, "b": 2.0},
+	}, {
+		name: "NestedChanged",
+		last: map[string]interface{}{"a": map[string]interface{}{"x": 1.0}, "b": "x"},
+		next: map[string]interface{}{"a": map[string]interface{}{"x": 2.0}, "b": "x"},
+		wantChanged: map[string]interface{}{
+			"a": map[string]interface{}{"x": 2.0},
+		},
+		wantRemoved: []string{},
+		wantOK:      true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			changed, removed, ok := diffFields(tc.last, tc.next)
+			if ok != tc.wantOK {
+				t.Fatalf("want ok %v, got %v", tc.wantOK, ok)
+			}
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(changed, tc.wantChanged) {
+				t.Errorf("want changed %v, got %v", tc.wantChanged, changed)
+			}
+			if !reflect.DeepEqual(removed, tc.wantRemoved) {
+				t.Errorf("want removed %v, got %v", tc.wantRemoved, removed)
+			}
+		})
+	}
+}
+
+func TestDiffPerPrefix(t *testing.T) {
+	color.NoColor = true
+	out := &bytes.Buffer{}
+	printer := NewPrinter(out)
+
+	printer.PrintRawLine("a", `{"level":"INFO","message":"Poll","fields":{"n":1,"x":"y"}}`)
+	printer.PrintRawLine("b", `{"level":"INFO","message":"Poll","fields":{"n":5,"x":"y"}}`)
+	printer.PrintRawLine("a", `{"level":"INFO","message":"Poll","fields":{"n":2,"x":"y"}}`)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var headings []string
+	for _, line := range lines {
+		if strings.Contains(line, "Poll") {
+			headings = append(headings, line)
+		}
+	}
+	want := []string{"a: INFO: Poll", "b: INFO: Poll", "a: ~ INFO: Poll"}
+	if !reflect.DeepEqual(headings, want) {
+		t.Errorf("want headings %q, got %q", want, headings)
+	}
+}
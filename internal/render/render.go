@@ -0,0 +1,236 @@
+// Package render formats log entries for humans. It is shared by log.PrettyLog
+// and the logcat printer so that both produce identical output.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultSeparator is printed before each entry unless Options.Separator is
+// set.
+const DefaultSeparator = "========"
+
+const (
+	fieldPrefix     = "| "
+	timestampFormat = "15:04:05.000"
+)
+
+var levelColors = map[string]color.Attribute{
+	"debug": color.FgBlue,
+	"info":  color.FgGreen,
+	"warn":  color.FgYellow,
+	"error": color.FgRed,
+}
+
+type Options struct {
+	// SkipFields are not printed
+	SkipFields map[string]struct{}
+
+	// Prefix is printed before the name prefix of every entry
+	Prefix string
+
+	// Separator is printed on a line before each entry, nil uses
+	// DefaultSeparator, empty prints nothing.
+	Separator *string
+
+	// Compact prints the entry and fields on a single line
+	Compact bool
+
+	// Timestamps prints the entry time before the level
+	Timestamps bool
+
+	ProtoJSON protojson.MarshalOptions
+}
+
+type Renderer struct {
+	options Options
+}
+
+func NewRenderer(options Options) *Renderer {
+	return &Renderer{
+		options: options,
+	}
+}
+
+// LevelColor returns the level name wrapped in its terminal color
+func LevelColor(level string) string {
+	whichColor, ok := levelColors[strings.ToLower(level)]
+	if !ok {
+		whichColor = color.FgWhite
+	}
+	return color.New(whichColor).Sprint(level)
+}
+
+func (r *Renderer) heading(buf *bytes.Buffer, namePrefix string, line string) {
+	separator := DefaultSeparator
+	if r.options.Separator != nil {
+		separator = *r.options.Separator
+	}
+	if separator != "" && !r.options.Compact {
+		fmt.Fprintf(buf, "%s\n", separator)
+	}
+
+	if r.options.Prefix != "" {
+		namePrefix = strings.TrimSpace(r.options.Prefix + " " + namePrefix)
+	}
+	if namePrefix != "" {
+		fmt.Fprintf(buf, "%s: %s", namePrefix, line)
+	} else {
+		fmt.Fprint(buf, line)
+	}
+}
+
+// Each entry is rendered in full then written with a single call, so entries
+// from concurrent loggers don't interleave, and a GuardedWriter sees whole
+// entries.
+func writeEntry(out io.Writer, buf *bytes.Buffer) {
+	out.Write(buf.Bytes()) // nolint: errcheck
+}
+
+// Raw prints a line which is not a log entry, e.g. non-JSON output.
+func (r *Renderer) Raw(out io.Writer, namePrefix string, line string) {
+	buf := &bytes.Buffer{}
+	r.heading(buf, namePrefix, line)
+	fmt.Fprint(buf, "\n")
+	writeEntry(out, buf)
+}
+
+// Entry prints a log entry with all fields which are not skipped, sorted by
+// key. A zero entryTime is not printed.
+func (r *Renderer) Entry(out io.Writer, namePrefix string, entryTime time.Time, level, message string, fields map[string]interface{}) {
+	buf := &bytes.Buffer{}
+	line := fmt.Sprintf("%s: %s", LevelColor(level), message)
+	if r.options.Timestamps && !entryTime.IsZero() {
+		line = entryTime.Local().Format(timestampFormat) + " " + line
+	}
+	r.heading(buf, namePrefix, line)
+
+	keys := r.sortedKeys(fields)
+	if r.options.Compact {
+		for _, k := range keys {
+			fmt.Fprintf(buf, " %s=%s", k, r.compactValue(fields[k]))
+		}
+		fmt.Fprint(buf, "\n")
+	} else {
+		fmt.Fprint(buf, "\n")
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s%s: %s\n", fieldPrefix, k, r.value(fields[k]))
+		}
+	}
+	writeEntry(out, buf)
+}
+
+// Diff prints an entry which is nearly identical to the previous entry as
+// only the changed and removed fields, highlighted.
+func (r *Renderer) Diff(out io.Writer, namePrefix string, level, message string, changed map[string]interface{}, removed []string) {
+	buf := &bytes.Buffer{}
+	highlight := color.New(color.FgCyan, color.Bold).SprintFunc()
+	removedColor := color.New(color.FgRed).SprintFunc()
+
+	if r.options.Prefix != "" {
+		namePrefix = strings.TrimSpace(r.options.Prefix + " " + namePrefix)
+	}
+	if namePrefix != "" {
+		fmt.Fprintf(buf, "%s: ~ %s: %s", namePrefix, LevelColor(level), message)
+	} else {
+		fmt.Fprintf(buf, "~ %s: %s", LevelColor(level), message)
+	}
+
+	keys := r.sortedKeys(changed)
+	if r.options.Compact {
+		for _, k := range keys {
+			fmt.Fprintf(buf, " %s=%s", k, highlight(r.compactValue(changed[k])))
+		}
+		for _, k := range removed {
+			fmt.Fprintf(buf, " %s", removedColor("-"+k))
+		}
+		fmt.Fprint(buf, "\n")
+	} else {
+		fmt.Fprint(buf, "\n")
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s%s: %s\n", fieldPrefix, k, highlight(r.compactValue(changed[k])))
+		}
+		for _, k := range removed {
+			fmt.Fprintf(buf, "%s%s\n", fieldPrefix, removedColor(k+": <removed>"))
+		}
+	}
+	writeEntry(out, buf)
+}
+
+func (r *Renderer) sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if _, skip := r.options.SkipFields[k]; skip {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scalar returns the plain string form of simple values
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return fmt.Sprintf("%v", v), true
+	case proto.Message:
+		// Generated messages are also Stringers
+		return "", false
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
+
+func (r *Renderer) marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return r.options.ProtoJSON.Marshal(msg)
+	}
+	return json.Marshal(v)
+}
+
+func (r *Renderer) value(v interface{}) string {
+	if str, ok := scalar(v); ok {
+		return str
+	}
+	valJSON, err := r.marshal(v)
+	if err != nil {
+		return fmt.Sprintf("Marshal Error: %s", err.Error())
+	}
+	nice := &bytes.Buffer{}
+	if err := json.Indent(nice, valJSON, fieldPrefix+" ", "  "); err != nil {
+		return string(valJSON)
+	}
+	return nice.String()
+}
+
+func (r *Renderer) compactValue(v interface{}) string {
+	if str, ok := scalar(v); ok {
+		return str
+	}
+	valJSON, err := r.marshal(v)
+	if err != nil {
+		return fmt.Sprintf("Marshal Error: %s", err.Error())
+	}
+	compact := &bytes.Buffer{}
+	if err := json.Compact(compact, valJSON); err != nil {
+		return string(valJSON)
+	}
+	return compact.String()
+}
@@ -0,0 +1,64 @@
+// Package sampling decides which request completion entries are logged by the
+// grpc_log and http_log interceptors.
+package sampling
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// Sampler keeps a fraction of successful completions. Kept entries carry the
+// number of completions they stand for, so totals can be reconstructed from
+// the logs.
+type Sampler struct {
+	rate          float64
+	alwaysOnError bool
+
+	lock    sync.Mutex
+	skipped map[skipKey]int64
+}
+
+// skipKey separates the skipped counts by key and outcome, so that a kept
+// entry only stands for completions like itself.
+type skipKey struct {
+	key     string
+	isError bool
+}
+
+func New(rate float64, alwaysOnError bool) *Sampler {
+	return &Sampler{
+		rate:          rate,
+		alwaysOnError: alwaysOnError,
+		skipped:       map[skipKey]int64{},
+	}
+}
+
+// Sample returns true when the entry should be logged, and the fields to add
+// to it. Slow requests are always logged, as are errors if alwaysOnError was
+// set. A nil Sampler logs everything.
+//
+// Skipped completions are counted per key, e.g. the gRPC method, and per
+// outcome, so the number of distinct keys should be bounded.
+func (s *Sampler) Sample(key string, isError, isSlow bool) (map[string]interface{}, bool) {
+	if s == nil {
+		return nil, true
+	}
+	if isSlow || (isError && s.alwaysOnError) {
+		return nil, true
+	}
+
+	counter := skipKey{key: key, isError: isError}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if rand.Float64() >= s.rate {
+		s.skipped[counter]++
+		return nil, false
+	}
+	count := s.skipped[counter] + 1
+	delete(s.skipped, counter)
+	return map[string]interface{}{
+		"sampled":     true,
+		"sampleRate":  s.rate,
+		"sampleCount": count,
+	}, true
+}
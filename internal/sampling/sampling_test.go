@@ -0,0 +1,57 @@
+package sampling
+
+import "testing"
+
+func TestSampler(t *testing.T) {
+	var nilSampler *Sampler
+	if _, keep := nilSampler.Sample("a", false, false); !keep {
+		t.Errorf("nil sampler should keep everything")
+	}
+
+	never := New(0, true)
+	for i := 0; i < 3; i++ {
+		if _, keep := never.Sample("a", false, false); keep {
+			t.Errorf("rate 0 should skip successful entries")
+		}
+	}
+	if _, keep := never.Sample("a", true, false); !keep {
+		t.Errorf("errors should be kept with alwaysOnError")
+	}
+	if _, keep := never.Sample("a", false, true); !keep {
+		t.Errorf("slow entries should always be kept")
+	}
+
+	never.rate = 1
+	fields, keep := never.Sample("a", false, false)
+	if !keep {
+		t.Fatalf("rate 1 should keep successful entries")
+	}
+	if fields["sampleCount"] != int64(4) {
+		t.Errorf("want sampleCount 4 for 3 skipped entries, got %v", fields["sampleCount"])
+	}
+}
+
+func TestSamplerCountsPerKey(t *testing.T) {
+	sampler := New(0, false)
+	sampler.Sample("a", false, false)
+	sampler.Sample("a", false, false)
+	sampler.Sample("b", false, false)
+	sampler.Sample("a", true, false)
+
+	sampler.rate = 1
+	for _, tc := range []struct {
+		key     string
+		isError bool
+		want    int64
+	}{
+		{key: "a", want: 3},
+		{key: "b", want: 2},
+		{key: "a", isError: true, want: 2},
+		{key: "c", want: 1},
+	} {
+		fields, _ := sampler.Sample(tc.key, tc.isError, false)
+		if fields["sampleCount"] != tc.want {
+			t.Errorf("%s error=%v: want sampleCount %d, got %v", tc.key, tc.isError, tc.want, fields["sampleCount"])
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxBufferedEntries caps the memory held for a single request, entries past
+// this are dropped and counted.
+const maxBufferedEntries = 1000
+
+type requestBufferKey struct{}
+
+type bufferedEntry struct {
+	callback LogFunc
+	level    string
+	message  string
+	fields   map[string]interface{}
+}
+
+type requestBuffer struct {
+	lock      sync.Mutex
+	startTime time.Time
+	finished  bool
+	entries   []bufferedEntry
+	dropped   int
+}
+
+// BufferRequest returns a context in which debug and info entries are held
+// rather than written, until FinishRequest is called. Warn and error entries
+// are written immediately. Buffered entries are captured even when they are
+// below the logger's level.
+func BufferRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestBufferKey{}, &requestBuffer{
+		startTime: time.Now(),
+	})
+}
+
+// FinishRequest writes the entries buffered by BufferRequest if the request
+// failed or took longer than SlowThreshold, otherwise they are dropped, and
+// entries logged in the context afterwards carry a bufferedDropped count.
+// Entries logged after FinishRequest are not buffered. Returns true if the
+// entries were written, so the grpc_log and http_log interceptors keep the
+// completion entry for a request SlowThreshold considered slow.
+func FinishRequest(ctx context.Context, err error) bool {
+	buffer := requestBufferFromContext(ctx)
+	if buffer == nil {
+		return false
+	}
+
+	buffer.lock.Lock()
+	if buffer.finished {
+		buffer.lock.Unlock()
+		return false
+	}
+	buffer.finished = true
+	entries := buffer.entries
+	buffer.entries = nil
+
+	slow := SlowThreshold > 0 && time.Since(buffer.startTime) > SlowThreshold
+	flush := err != nil || slow
+	if !flush {
+		buffer.dropped += len(entries)
+		entries = nil
+	}
+	buffer.lock.Unlock()
+
+	for _, entry := range entries {
+		entry.callback(entry.level, entry.message, entry.fields)
+	}
+	return flush
+}
+
+func requestBufferFromContext(ctx context.Context) *requestBuffer {
+	buffer, ok := ctx.Value(requestBufferKey{}).(*requestBuffer)
+	if !ok {
+		return nil
+	}
+	return buffer
+}
+
+// accepts returns true when the entry will be held by the buffer rather than
+// written. Safe to call on a nil buffer.
+func (rb *requestBuffer) accepts(level slog.Level) bool {
+	if rb == nil || level >= slog.LevelWarn {
+		return false
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	return !rb.finished
+}
+
+// add holds the entry, returning false if it should be written immediately.
+func (rb *requestBuffer) add(callback LogFunc, level slog.Level, msg string, fields map[string]interface{}) bool {
+	if rb == nil {
+		return false
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if rb.finished || level >= slog.LevelWarn {
+		if rb.finished && rb.dropped > 0 {
+			fields["bufferedDropped"] = rb.dropped
+		}
+		return false
+	}
+
+	if len(rb.entries) >= maxBufferedEntries {
+		rb.dropped++
+		return true
+	}
+
+	fields["bufferedAt"] = time.Now()
+	rb.entries = append(rb.entries, bufferedEntry{
+		callback: callback,
+		level:    level.String(),
+		message:  msg,
+		fields:   fields,
+	})
+	return true
+}
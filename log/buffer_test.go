@@ -0,0 +1,64 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBufferRequest(t *testing.T) {
+	logger, entries := captureLogger()
+	DefaultLogger = logger
+	logger.SetLevel(slog.LevelInfo)
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := BufferRequest(context.Background())
+		Debug(ctx, "Debug")
+		Info(ctx, "Info")
+		if len(entries.entries) != 0 {
+			t.Fatalf("want no entries before finish, got %d", len(entries.entries))
+		}
+
+		if FinishRequest(ctx, nil) {
+			t.Error("want FinishRequest to report dropped entries")
+		}
+		if len(entries.entries) != 0 {
+			t.Fatalf("want buffered entries dropped, got %d", len(entries.entries))
+		}
+
+		Info(ctx, "Complete")
+		assertEntry(t, Entry{
+			Message: "Complete",
+			Level:   infoLevel,
+			Fields:  map[string]interface{}{"bufferedDropped": 2},
+		}, entries)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		ctx := BufferRequest(context.Background())
+		Debug(ctx, "Debug")
+		Warn(ctx, "Warn")
+		assertEntry(t, Entry{Message: "Warn", Level: warnLevel}, entries)
+
+		if !FinishRequest(ctx, errors.New("failed")) {
+			t.Error("want FinishRequest to report written entries")
+		}
+		assertEntry(t, Entry{Message: "Debug", Level: debugLevel}, entries)
+	})
+
+	t.Run("Slow", func(t *testing.T) {
+		SlowThreshold = time.Millisecond
+		defer func() { SlowThreshold = 0 }()
+
+		ctx := BufferRequest(context.Background())
+		Info(ctx, "Info")
+		time.Sleep(5 * time.Millisecond)
+
+		if !FinishRequest(ctx, nil) {
+			t.Error("want FinishRequest to report written entries")
+		}
+		assertEntry(t, Entry{Message: "Info", Level: infoLevel}, entries)
+	})
+}
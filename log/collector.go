@@ -0,0 +1,126 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// collectorWithError is implemented by collectors which can report a failure
+// to the logger rather than returning empty fields, e.g. CollectorWithTimeout
+type collectorWithError interface {
+	logFieldsWithError(context.Context) (map[string]interface{}, error)
+}
+
+// collectFields calls the collector, converting a panic into an error so that
+// a broken collector does not take down the log call.
+func collectFields(ctx context.Context, collector ContextCollector) (fields map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collector %T panic: %v", collector, r)
+		}
+	}()
+	if withError, ok := collector.(collectorWithError); ok {
+		return withError.logFieldsWithError(ctx)
+	}
+	return collector.LogFieldsFromContext(ctx), nil
+}
+
+func sameCollector(a, b ContextCollector) (same bool) {
+	typeA := reflect.TypeOf(a)
+	if typeA != reflect.TypeOf(b) {
+		return false
+	}
+	if typeA == nil {
+		return true
+	}
+	if !typeA.Comparable() {
+		return false
+	}
+	// A comparable struct can still hold a non-comparable value in an
+	// interface field, which panics on ==
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+type timeoutCollector struct {
+	collector ContextCollector
+	timeout   time.Duration
+	// abandoned counts calls which timed out and are still running
+	abandoned atomic.Int32
+}
+
+// CollectorWithTimeout wraps a collector so that a call which does not return
+// within the timeout is abandoned, and the log entry is written with a
+// collector_error field in place of the collector's fields. While an
+// abandoned call is still running, further calls fail immediately rather than
+// starting another, so a hung collector holds at most one goroutine.
+func CollectorWithTimeout(collector ContextCollector, timeout time.Duration) ContextCollector {
+	return &timeoutCollector{
+		collector: collector,
+		timeout:   timeout,
+	}
+}
+
+func (tc *timeoutCollector) LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+	fields, err := tc.logFieldsWithError(ctx)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return fields
+}
+
+type collectorResult struct {
+	fields map[string]interface{}
+	err    error
+}
+
+func (tc *timeoutCollector) logFieldsWithError(ctx context.Context) (map[string]interface{}, error) {
+	if tc.abandoned.Load() > 0 {
+		return nil, fmt.Errorf("collector %T still running from a previous call", tc.collector)
+	}
+
+	// The goroutine and the timeout agree under lock on whether the call
+	// completed or was abandoned, so abandoned is only released by a call
+	// which was counted in it
+	var lock sync.Mutex
+	var finished, wasAbandoned bool
+
+	// Buffered so that an abandoned collector can still complete and exit
+	result := make(chan collectorResult, 1)
+	go func() {
+		fields, err := collectFields(ctx, tc.collector)
+		lock.Lock()
+		defer lock.Unlock()
+		finished = true
+		if wasAbandoned {
+			tc.abandoned.Add(-1)
+		}
+		result <- collectorResult{fields: fields, err: err}
+	}()
+
+	timer := time.NewTimer(tc.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-result:
+		return res.fields, res.err
+	case <-timer.C:
+		lock.Lock()
+		defer lock.Unlock()
+		if finished {
+			res := <-result
+			return res.fields, res.err
+		}
+		wasAbandoned = true
+		tc.abandoned.Add(1)
+		return nil, fmt.Errorf("collector %T timed out after %s", tc.collector, tc.timeout)
+	}
+}
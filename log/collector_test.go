@@ -0,0 +1,210 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type collectorFunc func(context.Context) map[string]interface{}
+
+func (cf collectorFunc) LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+	return cf(ctx)
+}
+
+type staticCollector struct {
+	key, value string
+}
+
+func (sc staticCollector) LogFieldsFromContext(context.Context) map[string]interface{} {
+	return map[string]interface{}{sc.key: sc.value}
+}
+
+func TestCollectorPanic(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+	logger.AddCollector(collectorFunc(func(context.Context) map[string]interface{} {
+		panic("collector broke")
+	}))
+
+	logger.Info(WithField(context.Background(), "key", "value"), "Message")
+
+	got := entries.entries[0]
+	collectorError, ok := got.Fields["collector_error"].(string)
+	if !ok || !strings.Contains(collectorError, "collector broke") {
+		t.Errorf("want collector_error with panic, got %#v", got.Fields["collector_error"])
+	}
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields:  map[string]interface{}{"key": "value"},
+	}, entries)
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+
+	release := make(chan struct{})
+	defer close(release)
+	logger.AddCollector(CollectorWithTimeout(collectorFunc(func(context.Context) map[string]interface{} {
+		<-release
+		return map[string]interface{}{"slow": "value"}
+	}), time.Millisecond))
+
+	logger.Info(context.Background(), "Message")
+
+	got := entries.entries[0]
+	if _, ok := got.Fields["slow"]; ok {
+		t.Errorf("fields from timed out collector should not be included")
+	}
+	collectorError, ok := got.Fields["collector_error"].(string)
+	if !ok || !strings.Contains(collectorError, "timed out") {
+		t.Errorf("want collector_error with timeout, got %#v", got.Fields["collector_error"])
+	}
+}
+
+func TestManageCollectors(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+	ctx := context.Background()
+
+	first := staticCollector{key: "first", value: "1"}
+	second := staticCollector{key: "second", value: "2"}
+
+	logger.SetCollectors(first, second)
+	logger.Info(ctx, "Message")
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields: map[string]interface{}{
+			"first":  "1",
+			"second": "2",
+		},
+	}, entries)
+
+	logger.RemoveCollector(first)
+	logger.Info(ctx, "Message")
+	got := entries.entries[0]
+	if _, ok := got.Fields["first"]; ok {
+		t.Errorf("removed collector should not be called")
+	}
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields:  map[string]interface{}{"second": "2"},
+	}, entries)
+}
+
+func TestCollectorTimeoutBounded(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+
+	release := make(chan struct{})
+	defer close(release)
+	logger.AddCollector(CollectorWithTimeout(collectorFunc(func(context.Context) map[string]interface{} {
+		<-release
+		return map[string]interface{}{}
+	}), time.Millisecond))
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		logger.Info(context.Background(), "Message")
+	}
+	if after := runtime.NumGoroutine(); after > before+1 {
+		t.Errorf("want at most one blocked collector call, goroutines went from %d to %d", before, after)
+	}
+
+	last := entries.entries[len(entries.entries)-1]
+	collectorError, ok := last.Fields["collector_error"].(string)
+	if !ok || !strings.Contains(collectorError, "still running") {
+		t.Errorf("want collector_error for call in flight, got %#v", last.Fields["collector_error"])
+	}
+}
+
+type funcHolder struct {
+	value interface{}
+}
+
+func (funcHolder) LogFieldsFromContext(context.Context) map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func TestRemoveNonComparableCollector(t *testing.T) {
+	logger, _ := captureLogger()
+	holder := funcHolder{value: func() {}}
+	logger.SetCollectors(holder)
+
+	// Must not panic comparing the func in the interface field
+	logger.RemoveCollector(holder)
+	if len(logger.currentCollectors()) != 1 {
+		t.Errorf("non-comparable collector can't be matched, want it kept")
+	}
+}
+
+func TestCollectorTimeoutConcurrent(t *testing.T) {
+	var lock sync.Mutex
+	var collected []map[string]interface{}
+	logger := NewCallbackLogger(func(_ string, _ string, fields map[string]interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		collected = append(collected, fields)
+	})
+	logger.SetCollectors(CollectorWithTimeout(collectorFunc(func(context.Context) map[string]interface{} {
+		time.Sleep(time.Millisecond)
+		return map[string]interface{}{"healthy": "value"}
+	}), time.Second))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info(context.Background(), "Message")
+		}()
+	}
+	wg.Wait()
+
+	if len(collected) != 20 {
+		t.Fatalf("want 20 entries, got %d", len(collected))
+	}
+	for _, fields := range collected {
+		if fields["healthy"] != "value" {
+			t.Errorf("want fields from a healthy collector, got %v", fields)
+		}
+	}
+}
+
+func TestCollectorConcurrentUpdate(t *testing.T) {
+	logger := NewCallbackLogger(func(string, string, map[string]interface{}) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			logger.AddCollector(staticCollector{key: "key", value: "value"})
+		}()
+		go func() {
+			defer wg.Done()
+			logger.Info(context.Background(), "Message")
+		}()
+	}
+	wg.Wait()
+
+	if got := len(logger.currentCollectors()); got != 12 {
+		t.Errorf("want 12 collectors, got %d", got)
+	}
+}
+
+// The log methods keep value receivers, so a CallbackLogger value satisfies
+// the grpc_log and http_log Logger interfaces
+var _ interface {
+	Debug(context.Context, string)
+	Info(context.Context, string)
+	Error(context.Context, string)
+} = CallbackLogger{}
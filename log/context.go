@@ -1,6 +1,10 @@
 package log
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 var DefaultContext FieldContextProvider = &MapContext{}
 
@@ -43,10 +47,28 @@ func WithField(ctx context.Context, key string, value interface{}) *WrappedConte
 	return WithFields(ctx, map[string]interface{}{key: value})
 }
 
+type errorTypeKey struct{}
+
+// WithError adds the error message as the error field. The type of the
+// innermost wrapped error is also kept in the context, but not logged, for
+// FingerprintCollector.
 func WithError(ctx context.Context, err error) *WrappedContext {
+	ctx = context.WithValue(ctx, errorTypeKey{}, innermostErrorType(err))
 	return WithField(ctx, "error", err.Error())
 }
 
+// innermostErrorType follows Unwrap, so that errors wrapped with fmt.Errorf
+// are identified by the cause rather than as *fmt.wrapError
+func innermostErrorType(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = inner
+	}
+}
+
 type MapContext struct{}
 
 var simpleContextKey = MapContext{}
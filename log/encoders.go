@@ -0,0 +1,94 @@
+package log
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+)
+
+// ValueEncoder converts a field value to the form written by every formatter
+type ValueEncoder func(v any) slog.Value
+
+type interfaceEncoder struct {
+	iface   reflect.Type
+	encoder ValueEncoder
+}
+
+var valueEncoders = struct {
+	sync.RWMutex
+	byType      map[reflect.Type]ValueEncoder
+	byInterface []interfaceEncoder
+}{
+	byType: map[reflect.Type]ValueEncoder{},
+}
+
+// RegisterValueEncoder sets the encoder for field values of the given type,
+// e.g. to log time.Duration as "1.2s" rather than nanoseconds. If the type is
+// an interface, the encoder applies to values implementing it, with exact
+// types taking precedence, then interfaces in the order registered.
+// Registering a type again replaces its encoder.
+func RegisterValueEncoder(t reflect.Type, encoder ValueEncoder) {
+	valueEncoders.Lock()
+	defer valueEncoders.Unlock()
+
+	if t.Kind() != reflect.Interface {
+		valueEncoders.byType[t] = encoder
+		return
+	}
+
+	for i, existing := range valueEncoders.byInterface {
+		if existing.iface == t {
+			valueEncoders.byInterface[i].encoder = encoder
+			return
+		}
+	}
+	valueEncoders.byInterface = append(valueEncoders.byInterface, interfaceEncoder{
+		iface:   t,
+		encoder: encoder,
+	})
+}
+
+// encodeFields replaces field values in place using the registered encoders
+func encodeFields(fields map[string]interface{}) {
+	valueEncoders.RLock()
+	defer valueEncoders.RUnlock()
+
+	if len(valueEncoders.byType) == 0 && len(valueEncoders.byInterface) == 0 {
+		return
+	}
+
+	for k, v := range fields {
+		if encoder := findEncoder(v); encoder != nil {
+			fields[k] = slogValueToAny(encoder(v))
+		}
+	}
+}
+
+func findEncoder(v any) ValueEncoder {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if encoder, ok := valueEncoders.byType[t]; ok {
+		return encoder
+	}
+	for _, ie := range valueEncoders.byInterface {
+		if t.Implements(ie.iface) {
+			return ie.encoder
+		}
+	}
+	return nil
+}
+
+// slogValueToAny converts groups to maps so that they encode as JSON objects
+func slogValueToAny(val slog.Value) any {
+	val = val.Resolve()
+	if val.Kind() != slog.KindGroup {
+		return val.Any()
+	}
+	group := map[string]any{}
+	for _, attr := range val.Group() {
+		group[attr.Key] = slogValueToAny(attr.Value)
+	}
+	return group
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testID struct {
+	value int
+}
+
+func (id testID) String() string {
+	return fmt.Sprintf("id-%d", id.value)
+}
+
+func TestRegisterValueEncoder(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+
+	defer func() {
+		valueEncoders.byType = map[reflect.Type]ValueEncoder{}
+		valueEncoders.byInterface = nil
+	}()
+
+	RegisterValueEncoder(reflect.TypeOf(time.Duration(0)), func(v any) slog.Value {
+		return slog.StringValue(v.(time.Duration).String())
+	})
+	RegisterValueEncoder(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), func(v any) slog.Value {
+		return slog.StringValue("stringer:" + v.(fmt.Stringer).String())
+	})
+
+	ctx := WithFields(context.Background(), map[string]interface{}{
+		"duration": 1200 * time.Millisecond,
+		"id":       testID{value: 1},
+		"plain":    1,
+	})
+	logger.Info(ctx, "Message")
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields: map[string]interface{}{
+			"duration": "1.2s",
+			"id":       "stringer:id-1",
+			"plain":    1,
+		},
+	}, entries)
+
+	logger.ErrorContext(context.Background(), "Message", "duration", time.Second)
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   errorLevel,
+		Fields:  map[string]interface{}{"duration": "1s"},
+	}, entries)
+}
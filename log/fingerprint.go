@@ -0,0 +1,108 @@
+package log
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+const logPackagePrefix = "github.com/pentops/log.go/log."
+
+var fingerprintPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`0x[0-9a-fA-F]+`), "<hex>"},
+	{regexp.MustCompile(`[0-9]+(\.[0-9]+)?`), "<num>"},
+}
+
+// fingerprintErrorTypeField carries the error type from FingerprintCollector
+// to WithFingerprint, which removes it before the entry is written
+const fingerprintErrorTypeField = "fingerprintErrorType"
+
+// FingerprintCollector passes the type of the error set by WithError to
+// WithFingerprint. Add it to a logger using WithFingerprint, as init does when
+// LOG_FINGERPRINT is set. The type is not written to the entry.
+var FingerprintCollector ContextCollector = errorTypeCollector{}
+
+type errorTypeCollector struct{}
+
+func (errorTypeCollector) LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+	errType, ok := ctx.Value(errorTypeKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{fingerprintErrorTypeField: errType}
+}
+
+// WithFingerprint adds a fingerprint field to warn and error entries, a hash
+// of the message with variable parts (numbers, IDs, quoted strings) removed,
+// the error type (from FingerprintCollector, or the innermost type of an
+// error value in the error field, falling back to its normalized text), and
+// the function which made the log call. Occurrences of the same failure share a
+// fingerprint across processes and over time.
+func WithFingerprint(next LogFunc) LogFunc {
+	return func(level string, msg string, fields map[string]interface{}) {
+		errType, _ := fields[fingerprintErrorTypeField].(string)
+		delete(fields, fingerprintErrorTypeField)
+		var parsed slog.Level
+		if err := parsed.UnmarshalText([]byte(level)); err != nil || parsed >= slog.LevelWarn {
+			fields["fingerprint"] = fingerprint(msg, errType, fields["error"], callerFunction())
+		}
+		next(level, msg, fields)
+	}
+}
+
+func fingerprint(msg string, errType string, errField interface{}, caller string) string {
+	errPart := errType
+	switch errVal := errField.(type) {
+	case nil:
+	case error:
+		errPart = innermostErrorType(errVal)
+	case string:
+		if errPart == "" {
+			errPart = normalizeMessage(errVal)
+		}
+	default:
+		errPart = fmt.Sprintf("%T", errVal)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		normalizeMessage(msg),
+		errPart,
+		caller,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func normalizeMessage(msg string) string {
+	for _, p := range fingerprintPatterns {
+		msg = p.pattern.ReplaceAllString(msg, p.replacement)
+	}
+	return msg
+}
+
+// callerFunction returns the first function on the stack outside of this
+// package. Line numbers are excluded so that the fingerprint survives
+// unrelated changes to the file.
+func callerFunction() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, logPackagePrefix) {
+			return frame.Function
+		}
+		if !more {
+			return ""
+		}
+	}
+}
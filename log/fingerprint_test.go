@@ -0,0 +1,77 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+type notFoundError struct {
+	id int
+}
+
+func (nf notFoundError) Error() string {
+	return fmt.Sprintf("item %d not found", nf.id)
+}
+
+func TestFingerprint(t *testing.T) {
+	var got []map[string]interface{}
+	logger := &CallbackLogger{
+		Callback: WithFingerprint(func(level string, msg string, fields map[string]interface{}) {
+			got = append(got, fields)
+		}),
+		Collectors: []ContextCollector{DefaultContext, FingerprintCollector},
+	}
+	logger.SetLevel(slog.LevelDebug)
+
+	logFailure := func(id int, err error) {
+		ctx := WithError(context.Background(), err)
+		logger.Error(ctx, fmt.Sprintf("Failed to load item %d", id))
+	}
+
+	logFailure(1, errors.New("one"))
+	logFailure(2, errors.New("two"))
+	logFailure(3, notFoundError{id: 3})
+	logger.Info(context.Background(), "Info")
+	logFailure(4, fmt.Errorf("loading: %w", errors.New("four")))
+	logFailure(5, fmt.Errorf("loading: %w", notFoundError{id: 5}))
+
+	if len(got) != 6 {
+		t.Fatalf("want 6 entries, got %d", len(got))
+	}
+	for _, fields := range got {
+		if _, ok := fields[fingerprintErrorTypeField]; ok {
+			t.Errorf("the error type should not be written, got %v", fields)
+		}
+	}
+	first, ok := got[0]["fingerprint"].(string)
+	if !ok || first == "" {
+		t.Fatalf("want fingerprint, got %#v", got[0]["fingerprint"])
+	}
+	if got[1]["fingerprint"] != first {
+		t.Errorf("want matching fingerprints for the same failure, got %s and %s", first, got[1]["fingerprint"])
+	}
+	if got[2]["fingerprint"] == first {
+		t.Errorf("want different fingerprint for a different error type")
+	}
+	if _, ok := got[3]["fingerprint"]; ok {
+		t.Errorf("want no fingerprint on info entries")
+	}
+	if got[4]["fingerprint"] == got[5]["fingerprint"] {
+		t.Errorf("want wrapped errors fingerprinted by their innermost type")
+	}
+}
+
+func TestWithErrorFields(t *testing.T) {
+	logger, entries := captureLogger()
+	logger.SetLevel(slog.LevelDebug)
+
+	logger.Error(WithError(context.Background(), errors.New("failed")), "Message")
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   errorLevel,
+		Fields:  map[string]interface{}{"error": "failed"},
+	}, entries)
+}
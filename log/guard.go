@@ -0,0 +1,197 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MetricDroppedLogs counts writes dropped by a GuardedWriter
+	MetricDroppedLogs = "dropped_logs"
+
+	// MetricLogWriteErrors counts writes by a GuardedWriter which failed or
+	// timed out
+	MetricLogWriteErrors = "log_write_errors"
+)
+
+// MetricsHook receives counter increments from the log package, see the
+// Metric constants.
+type MetricsHook func(name string, delta int64)
+
+var metricsHook atomic.Pointer[MetricsHook]
+
+// SetMetricsHook sets the hook which receives log package counters, replacing
+// any previous hook.
+func SetMetricsHook(hook MetricsHook) {
+	metricsHook.Store(&hook)
+}
+
+func countMetric(name string, delta int64) {
+	if hook := metricsHook.Load(); hook != nil && *hook != nil {
+		(*hook)(name, delta)
+	}
+}
+
+type guardOptions struct {
+	writeTimeout     time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+type GuardOption func(*guardOptions)
+
+// WithWriteTimeout sets how long a write may take before it is abandoned.
+func WithWriteTimeout(timeout time.Duration) GuardOption {
+	return func(o *guardOptions) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failed writes after
+// which writes are dropped without being attempted.
+func WithFailureThreshold(failures int) GuardOption {
+	return func(o *guardOptions) {
+		o.failureThreshold = failures
+	}
+}
+
+// WithCooldown sets how long writes are dropped for once the failure
+// threshold is reached, before a write is attempted again.
+func WithCooldown(cooldown time.Duration) GuardOption {
+	return func(o *guardOptions) {
+		o.cooldown = cooldown
+	}
+}
+
+// GuardedWriter protects the application from a stalled or failing writer,
+// such as a blocked stderr pipe or a full disk. Each write waits at most the
+// write timeout. After consecutive failures the writer drops entries for a
+// cooldown period rather than attempting them. Writes never return an error,
+// failures are counted instead.
+type GuardedWriter struct {
+	out     io.Writer
+	options guardOptions
+	writes  chan guardedWrite
+
+	lock                sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+
+	errors  atomic.Int64
+	dropped atomic.Int64
+}
+
+type guardedWrite struct {
+	data   []byte
+	result chan error
+}
+
+// GuardWriter wraps the writer, starting a goroutine which performs the
+// writes for the life of the process.
+func GuardWriter(out io.Writer, opts ...GuardOption) *GuardedWriter {
+	options := guardOptions{
+		writeTimeout:     time.Second,
+		failureThreshold: 3,
+		cooldown:         10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	gw := &GuardedWriter{
+		out:     out,
+		options: options,
+		writes:  make(chan guardedWrite),
+	}
+	go gw.run()
+	return gw
+}
+
+func (gw *GuardedWriter) run() {
+	for write := range gw.writes {
+		_, err := gw.out.Write(write.data)
+		write.result <- err
+	}
+}
+
+func (gw *GuardedWriter) Write(data []byte) (int, error) {
+	if gw.isOpen() {
+		gw.drop()
+		return len(data), nil
+	}
+
+	// The write may complete after this call returns, so the caller's buffer
+	// can't be used.
+	write := guardedWrite{
+		data:   append([]byte{}, data...),
+		result: make(chan error, 1),
+	}
+
+	timer := time.NewTimer(gw.options.writeTimeout)
+	defer timer.Stop()
+
+	select {
+	case gw.writes <- write:
+	case <-timer.C:
+		// A previous write is still stuck
+		gw.fail()
+		gw.drop()
+		return len(data), nil
+	}
+
+	select {
+	case err := <-write.result:
+		if err != nil {
+			gw.fail()
+			gw.drop()
+			return len(data), nil
+		}
+		gw.succeed()
+	case <-timer.C:
+		gw.fail()
+	}
+	return len(data), nil
+}
+
+// Dropped returns the number of writes which were not written
+func (gw *GuardedWriter) Dropped() int64 {
+	return gw.dropped.Load()
+}
+
+// Errors returns the number of writes which failed or timed out
+func (gw *GuardedWriter) Errors() int64 {
+	return gw.errors.Load()
+}
+
+func (gw *GuardedWriter) isOpen() bool {
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	return time.Now().Before(gw.openUntil)
+}
+
+func (gw *GuardedWriter) drop() {
+	gw.dropped.Add(1)
+	countMetric(MetricDroppedLogs, 1)
+}
+
+func (gw *GuardedWriter) fail() {
+	gw.errors.Add(1)
+	countMetric(MetricLogWriteErrors, 1)
+
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	gw.consecutiveFailures++
+	if gw.consecutiveFailures >= gw.options.failureThreshold {
+		gw.openUntil = time.Now().Add(gw.options.cooldown)
+		// After the cooldown, a single failure opens the breaker again
+		gw.consecutiveFailures = gw.options.failureThreshold - 1
+	}
+}
+
+func (gw *GuardedWriter) succeed() {
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	gw.consecutiveFailures = 0
+}
@@ -0,0 +1,100 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stallingWriter struct {
+	sync.Mutex
+	stall   chan struct{}
+	fail    bool
+	written bytes.Buffer
+}
+
+func (sw *stallingWriter) Write(data []byte) (int, error) {
+	if sw.stall != nil {
+		<-sw.stall
+	}
+	sw.Lock()
+	defer sw.Unlock()
+	if sw.fail {
+		return 0, errors.New("disk full")
+	}
+	return sw.written.Write(data)
+}
+
+func TestGuardedWriterStalled(t *testing.T) {
+	var droppedMetric int64
+	SetMetricsHook(func(name string, delta int64) {
+		if name == MetricDroppedLogs {
+			droppedMetric += delta
+		}
+	})
+	defer SetMetricsHook(nil)
+
+	out := &stallingWriter{
+		stall: make(chan struct{}),
+	}
+	gw := GuardWriter(out,
+		WithWriteTimeout(time.Millisecond),
+		WithFailureThreshold(2),
+		WithCooldown(time.Hour),
+	)
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if _, err := gw.Write([]byte("line\n")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("write blocked")
+		}
+	}
+	close(out.stall)
+
+	if gw.Errors() != 2 {
+		t.Errorf("want 2 errors before the breaker opens, got %d", gw.Errors())
+	}
+	// The first write was handed to the stalled writer and timed out, but
+	// still completes. The second couldn't be handed over, and the rest were
+	// dropped by the open breaker.
+	if gw.Dropped() != 4 {
+		t.Errorf("want 4 dropped, got %d", gw.Dropped())
+	}
+	if droppedMetric != gw.Dropped() {
+		t.Errorf("want metric %d, got %d", gw.Dropped(), droppedMetric)
+	}
+}
+
+func TestGuardedWriterRecovers(t *testing.T) {
+	out := &stallingWriter{
+		fail: true,
+	}
+	gw := GuardWriter(out,
+		WithWriteTimeout(time.Second),
+		WithFailureThreshold(1),
+		WithCooldown(time.Millisecond),
+	)
+
+	gw.Write([]byte("failed\n"))  // nolint: errcheck
+	gw.Write([]byte("dropped\n")) // nolint: errcheck
+	if gw.Dropped() != 2 {
+		t.Errorf("want 2 dropped, got %d", gw.Dropped())
+	}
+
+	out.Lock()
+	out.fail = false
+	out.Unlock()
+	time.Sleep(2 * time.Millisecond)
+
+	gw.Write([]byte("written\n")) // nolint: errcheck
+	out.Lock()
+	defer out.Unlock()
+	if out.written.String() != "written\n" {
+		t.Errorf("want write after cooldown, got %q", out.written.String())
+	}
+}
@@ -10,9 +10,12 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fatih/color"
+	"github.com/pentops/log.go/internal/render"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 type Logger interface {
@@ -32,16 +35,49 @@ var DefaultLogger Logger
 
 func init() {
 
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if writeTimeout := os.Getenv("LOG_WRITE_TIMEOUT"); writeTimeout != "" {
+		// A zero or negative timeout would drop every entry
+		if parsed, err := time.ParseDuration(writeTimeout); err == nil && parsed > 0 {
+			stdout = GuardWriter(os.Stdout, WithWriteTimeout(parsed))
+			stderr = GuardWriter(os.Stderr, WithWriteTimeout(parsed))
+		}
+	}
+
 	logFormat := os.Getenv("LOG_FORMAT")
+	splitOutput := os.Getenv("LOG_SPLIT") == "1"
 	var formatter LogFunc
 	switch logFormat {
 	case "pretty":
-		formatter = PrettyLog(os.Stderr, SkipFields("version", "app"))
+		// Service fields are the same on every entry, so are just noise
+		skipServiceFields := SkipFields("app", "version", "env", "region", "instance")
+		formatter = PrettyLog(stderr, skipServiceFields)
+		if splitOutput {
+			formatter = splitLevel(slog.LevelError,
+				PrettyLog(stdout, skipServiceFields),
+				formatter)
+		}
 	default: // json and not set
-		formatter = JSONLog(os.Stderr)
+		var jsonOptions []LoggerOption
+		if os.Getenv("LOG_SCHEMA") == "1" {
+			jsonOptions = append(jsonOptions, IncludeSchema())
+		}
+		if splitOutput {
+			formatter = SplitByLevel(stdout, stderr, slog.LevelError, jsonOptions...)
+		} else {
+			formatter = JSONLog(stderr, jsonOptions...)
+		}
+	}
+
+	fingerprinting := os.Getenv("LOG_FINGERPRINT") == "1"
+	if fingerprinting {
+		formatter = WithFingerprint(formatter)
 	}
 
 	DefaultLogger = NewCallbackLogger(formatter)
+	if fingerprinting {
+		DefaultLogger.AddCollector(FingerprintCollector)
+	}
 
 	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
 	case "debug":
@@ -56,6 +92,16 @@ func init() {
 		DefaultLogger.SetLevel(slog.LevelInfo)
 	}
 
+	if os.Getenv("SERVICE_NAME") != "" {
+		SetServiceContext(ServiceContextFromEnv())
+	}
+
+	if slowThreshold := os.Getenv("LOG_SLOW_THRESHOLD"); slowThreshold != "" {
+		if parsed, err := time.ParseDuration(slowThreshold); err == nil {
+			SlowThreshold = parsed
+		}
+	}
+
 }
 
 func Debug(ctx context.Context, msg string) {
@@ -109,12 +155,26 @@ type CallbackLogger struct {
 	Level      slog.Level
 	Callback   LogFunc
 	Collectors []ContextCollector
+
+	// runtimeCollectors replaces Collectors once AddCollector, RemoveCollector
+	// or SetCollectors is called. It is a pointer so that the log methods,
+	// which have value receivers, share it and its lock.
+	runtimeCollectors *collectorSet
+}
+
+// collectorSet is replaced rather than modified in place so that a log call
+// can iterate a snapshot without holding the lock
+type collectorSet struct {
+	lock       sync.RWMutex
+	set        bool
+	collectors []ContextCollector
 }
 
 func NewCallbackLogger(callback LogFunc) *CallbackLogger {
 	return &CallbackLogger{
-		Callback:   callback,
-		Collectors: []ContextCollector{DefaultContext, DefaultTrace},
+		Callback:          callback,
+		Collectors:        []ContextCollector{DefaultContext, DefaultTrace},
+		runtimeCollectors: &collectorSet{},
 	}
 }
 
@@ -138,8 +198,65 @@ func (sl CallbackLogger) Error(ctx context.Context, msg string) {
 	sl.log(ctx, slog.LevelError, msg)
 }
 
+// updateCollectors replaces the collectors with the result of update. A
+// logger created with NewCallbackLogger can be updated while in use, one
+// created as a struct literal only before it is shared.
+func (sl *CallbackLogger) updateCollectors(update func([]ContextCollector) []ContextCollector) {
+	if sl.runtimeCollectors == nil {
+		sl.runtimeCollectors = &collectorSet{}
+	}
+	rc := sl.runtimeCollectors
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	current := sl.Collectors
+	if rc.set {
+		current = rc.collectors
+	}
+	rc.collectors = update(current)
+	rc.set = true
+}
+
+// currentCollectors returns the collectors as last set at runtime, or
+// Collectors if they have not been changed.
+func (sl CallbackLogger) currentCollectors() []ContextCollector {
+	if rc := sl.runtimeCollectors; rc != nil {
+		rc.lock.RLock()
+		defer rc.lock.RUnlock()
+		if rc.set {
+			return rc.collectors
+		}
+	}
+	return sl.Collectors
+}
+
 func (sl *CallbackLogger) AddCollector(collector ContextCollector) {
-	sl.Collectors = append(sl.Collectors, collector)
+	sl.updateCollectors(func(current []ContextCollector) []ContextCollector {
+		collectors := make([]ContextCollector, 0, len(current)+1)
+		collectors = append(collectors, current...)
+		return append(collectors, collector)
+	})
+}
+
+// RemoveCollector removes all instances of the collector from the logger.
+// Collectors are matched by equality, so collectors with non-comparable
+// dynamic types can only be removed with SetCollectors.
+func (sl *CallbackLogger) RemoveCollector(collector ContextCollector) {
+	sl.updateCollectors(func(current []ContextCollector) []ContextCollector {
+		collectors := make([]ContextCollector, 0, len(current))
+		for _, existing := range current {
+			if !sameCollector(existing, collector) {
+				collectors = append(collectors, existing)
+			}
+		}
+		return collectors
+	})
+}
+
+// SetCollectors replaces all collectors on the logger, including the defaults
+func (sl *CallbackLogger) SetCollectors(collectors ...ContextCollector) {
+	sl.updateCollectors(func([]ContextCollector) []ContextCollector {
+		return append([]ContextCollector{}, collectors...)
+	})
 }
 
 func (sl CallbackLogger) InfoContext(ctx context.Context, msg string, args ...any) {
@@ -155,7 +272,8 @@ func (sl CallbackLogger) ErrorContext(ctx context.Context, msg string, args ...a
 }
 
 func (sl CallbackLogger) slog(ctx context.Context, level slog.Level, msg string, args []any) {
-	if level < sl.Level {
+	buffer := requestBufferFromContext(ctx)
+	if level < sl.Level && !buffer.accepts(level) {
 		return
 	}
 
@@ -165,27 +283,47 @@ func (sl CallbackLogger) slog(ctx context.Context, level slog.Level, msg string,
 	record := slog.NewRecord(time.Time{}, level, msg, 0)
 	record.Add(args...)
 	record.Attrs(func(attr slog.Attr) bool {
-		fields[attr.Key] = attr.Value
+		fields[attr.Key] = slogValueToAny(attr.Value)
 		return true
 	})
+	encodeFields(fields)
+	if buffer.add(sl.Callback, level, msg, fields) || level < sl.Level {
+		return
+	}
 	sl.Callback(level.String(), msg, fields)
 }
 
 func (sl CallbackLogger) extractFields(ctx context.Context) map[string]interface{} {
+	collectors := sl.currentCollectors()
+
 	fields := map[string]interface{}{}
-	for _, cb := range sl.Collectors {
-		for k, v := range cb.LogFieldsFromContext(ctx) {
+	var collectorErrors []string
+	for _, cb := range collectors {
+		collected, err := collectFields(ctx, cb)
+		if err != nil {
+			collectorErrors = append(collectorErrors, err.Error())
+			continue
+		}
+		for k, v := range collected {
 			fields[k] = v
 		}
 	}
+	if len(collectorErrors) > 0 {
+		fields["collector_error"] = strings.Join(collectorErrors, "; ")
+	}
 	return fields
 }
 
 func (sl CallbackLogger) log(ctx context.Context, level slog.Level, msg string) {
-	if level < sl.Level {
+	buffer := requestBufferFromContext(ctx)
+	if level < sl.Level && !buffer.accepts(level) {
 		return
 	}
 	fields := sl.extractFields(ctx)
+	encodeFields(fields)
+	if buffer.add(sl.Callback, level, msg, fields) || level < sl.Level {
+		return
+	}
 	sl.Callback(level.String(), msg, fields)
 }
 
@@ -208,17 +346,11 @@ type ContextCollector interface {
 	LogFieldsFromContext(context.Context) map[string]interface{}
 }
 
-type logEntry struct {
-	Level   string                 `json:"level"`
-	Time    time.Time              `json:"time"`
-	Message string                 `json:"message"`
-	Fields  map[string]interface{} `json:"fields"`
-}
-
-func jsonFormatter(out io.Writer, entry logEntry) {
+func jsonFormatter(out io.Writer, entry Entry) {
 	logLine, err := json.Marshal(entry)
 	if err != nil {
-		logLine, _ = json.Marshal(logEntry{
+		logLine, _ = json.Marshal(Entry{
+			Schema:  entry.Schema,
 			Message: entry.Message,
 			Time:    entry.Time,
 			Level:   entry.Level,
@@ -230,9 +362,16 @@ func jsonFormatter(out io.Writer, entry logEntry) {
 }
 
 func SimplifyFields(fields map[string]interface{}) map[string]interface{} {
+	return simplifyFields(fields, protojson.MarshalOptions{})
+}
+
+func simplifyFields(fields map[string]interface{}, protoOptions protojson.MarshalOptions) map[string]interface{} {
 	simplified := map[string]interface{}{}
 	for k, v := range fields {
-		if err, ok := v.(error); ok {
+		// Generated messages are also Stringers, so this check comes first
+		if msg, ok := v.(proto.Message); ok {
+			v = protoField(msg, protoOptions)
+		} else if err, ok := v.(error); ok {
 			v = err.Error()
 		} else if err, ok := v.(fmt.Stringer); ok {
 			v = err.String()
@@ -243,20 +382,61 @@ func SimplifyFields(fields map[string]interface{}) map[string]interface{} {
 	return simplified
 }
 
-func JSONLog(out io.Writer) LogFunc {
+func JSONLog(out io.Writer, optionFuncs ...LoggerOption) LogFunc {
+	options := &loggerOptions{}
+	for _, f := range optionFuncs {
+		f(options)
+	}
+
+	var schema string
+	if options.includeSchema {
+		schema = EntrySchemaVersion
+	}
+
 	return func(level string, msg string, fields map[string]interface{}) {
 
-		jsonFormatter(out, logEntry{
+		jsonFormatter(out, Entry{
+			Schema:  schema,
 			Level:   level,
 			Time:    time.Now(),
 			Message: msg,
-			Fields:  SimplifyFields(fields),
+			Fields:  simplifyFields(fields, options.protoJSON),
 		})
 	}
 }
 
+// SplitByLevel writes JSON entries at or above the threshold level to stderr,
+// and all others to stdout, for platforms which treat stderr as an error
+// stream.
+func SplitByLevel(stdout, stderr io.Writer, threshold slog.Level, optionFuncs ...LoggerOption) LogFunc {
+	return splitLevel(threshold, JSONLog(stdout, optionFuncs...), JSONLog(stderr, optionFuncs...))
+}
+
+func splitLevel(threshold slog.Level, below, above LogFunc) LogFunc {
+	return func(level string, msg string, fields map[string]interface{}) {
+		var parsed slog.Level
+		if err := parsed.UnmarshalText([]byte(level)); err != nil {
+			// Unknown levels are not hidden from the error stream
+			above(level, msg, fields)
+			return
+		}
+		if parsed >= threshold {
+			above(level, msg, fields)
+		} else {
+			below(level, msg, fields)
+		}
+	}
+}
+
 type loggerOptions struct {
-	skipFields map[string]struct{}
+	skipFields    map[string]struct{}
+	includeSchema bool
+	protoJSON     protojson.MarshalOptions
+
+	prettyPrefix     string
+	prettySeparator  *string
+	prettyCompact    bool
+	prettyTimestamps bool
 }
 
 type LoggerOption func(*loggerOptions)
@@ -272,42 +452,53 @@ func SkipFields(fields ...string) LoggerOption {
 	}
 }
 
+// PrettyLog writes entries for humans, in the same format as logcat.
 func PrettyLog(out io.Writer, optionFuncs ...LoggerOption) LogFunc {
-	var levelColors = map[string]color.Attribute{
-		"debug": color.FgBlue,
-		"info":  color.FgGreen,
-		"warn":  color.FgYellow,
-		"error": color.FgRed,
-	}
-
 	options := &loggerOptions{}
 
 	for _, f := range optionFuncs {
 		f(options)
 	}
 
+	renderer := render.NewRenderer(render.Options{
+		SkipFields: options.skipFields,
+		Prefix:     options.prettyPrefix,
+		Separator:  options.prettySeparator,
+		Compact:    options.prettyCompact,
+		Timestamps: options.prettyTimestamps,
+		ProtoJSON:  options.protoJSON,
+	})
+
 	return func(level string, msg string, fields map[string]interface{}) {
-		whichColor, ok := levelColors[strings.ToLower(level)]
-		if !ok {
-			whichColor = color.FgWhite
-		}
+		renderer.Entry(out, "", time.Now(), level, msg, fields)
+	}
+}
 
-		levelColor := color.New(whichColor).SprintFunc()
-		fmt.Fprintf(out, "%s: %s\n", levelColor(level), msg)
+// PrettyPrefix is printed before every entry by PrettyLog
+func PrettyPrefix(prefix string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.prettyPrefix = prefix
+	}
+}
 
-		for k, v := range fields {
-			if _, skip := options.skipFields[k]; skip {
-				continue
-			}
+// PrettySeparator replaces the line printed before each entry by PrettyLog,
+// an empty separator prints nothing.
+func PrettySeparator(separator string) LoggerOption {
+	return func(o *loggerOptions) {
+		o.prettySeparator = &separator
+	}
+}
 
-			switch v.(type) {
-			case string, int, int64, int32, float64, bool:
-				fmt.Fprintf(out, "  | %s: %v\n", k, v)
-			default:
-				nice, _ := json.MarshalIndent(v, "  |  ", "  ")
-				fmt.Fprintf(out, "  | %s: %s\n", k, string(nice))
-			}
-		}
+// PrettyCompact prints each entry on a single line in PrettyLog
+func PrettyCompact() LoggerOption {
+	return func(o *loggerOptions) {
+		o.prettyCompact = true
+	}
+}
 
+// PrettyTimestamps prints the time of each entry in PrettyLog
+func PrettyTimestamps() LoggerOption {
+	return func(o *loggerOptions) {
+		o.prettyTimestamps = true
 	}
 }
@@ -8,10 +8,10 @@ import (
 )
 
 type logLines struct {
-	entries []logEntry
+	entries []Entry
 }
 
-func assertEntry(t *testing.T, want logEntry, lines *logLines) {
+func assertEntry(t *testing.T, want Entry, lines *logLines) {
 	t.Helper()
 	if len(lines.entries) == 0 {
 		t.Fatalf("No log entries")
@@ -20,7 +20,7 @@ func assertEntry(t *testing.T, want logEntry, lines *logLines) {
 		t.Fatalf("More than one log entry")
 	}
 	got := lines.entries[0]
-	lines.entries = make([]logEntry, 0)
+	lines.entries = make([]Entry, 0)
 
 	if want.Level != got.Level {
 		t.Errorf("Want level %s got %s", want.Level, got.Level)
@@ -45,10 +45,10 @@ func assertEntry(t *testing.T, want logEntry, lines *logLines) {
 
 }
 
-func captureLogger() (Logger, *logLines) {
+func captureLogger() (*CallbackLogger, *logLines) {
 	ll := &logLines{}
 	format := func(level string, msg string, fields map[string]interface{}) {
-		ll.entries = append(ll.entries, logEntry{
+		ll.entries = append(ll.entries, Entry{
 			Level:   level,
 			Time:    time.Now(),
 			Message: msg,
@@ -64,6 +64,7 @@ func captureLogger() (Logger, *logLines) {
 const (
 	debugLevel = "DEBUG"
 	infoLevel  = "INFO"
+	warnLevel  = "WARN"
 	errorLevel = "ERROR"
 )
 
@@ -75,22 +76,22 @@ func TestDefaultLogger(t *testing.T) {
 	ctx := context.Background()
 
 	Debug(ctx, "Message")
-	assertEntry(t, logEntry{Message: "Message", Level: debugLevel}, entries)
+	assertEntry(t, Entry{Message: "Message", Level: debugLevel}, entries)
 
 	Debugf(ctx, "Message %s", "string")
-	assertEntry(t, logEntry{Message: "Message string", Level: debugLevel}, entries)
+	assertEntry(t, Entry{Message: "Message string", Level: debugLevel}, entries)
 
 	Info(ctx, "Message")
-	assertEntry(t, logEntry{Message: "Message", Level: infoLevel}, entries)
+	assertEntry(t, Entry{Message: "Message", Level: infoLevel}, entries)
 
 	Infof(ctx, "Message %s", "string")
-	assertEntry(t, logEntry{Message: "Message string", Level: infoLevel}, entries)
+	assertEntry(t, Entry{Message: "Message string", Level: infoLevel}, entries)
 
 	Error(ctx, "Message")
-	assertEntry(t, logEntry{Message: "Message", Level: errorLevel}, entries)
+	assertEntry(t, Entry{Message: "Message", Level: errorLevel}, entries)
 
 	Errorf(ctx, "Message %s", "string")
-	assertEntry(t, logEntry{Message: "Message string", Level: errorLevel}, entries)
+	assertEntry(t, Entry{Message: "Message string", Level: errorLevel}, entries)
 
 }
 
@@ -102,7 +103,7 @@ func TestContext(t *testing.T) {
 
 	t.Run("TestWithField", func(t *testing.T) {
 		logger.Debug(WithField(ctx, "key", "value"), "Message")
-		assertEntry(t, logEntry{
+		assertEntry(t, Entry{
 			Message: "Message",
 			Level:   debugLevel,
 			Fields:  map[string]interface{}{"key": "value"},
@@ -112,7 +113,7 @@ func TestContext(t *testing.T) {
 	t.Run("TestWithFields", func(t *testing.T) {
 		ctx := WithFields(ctx, map[string]interface{}{"key": "value"})
 		logger.Debug(ctx, "Message")
-		assertEntry(t, logEntry{
+		assertEntry(t, Entry{
 			Message: "Message",
 			Level:   debugLevel,
 			Fields: map[string]interface{}{
@@ -131,7 +132,7 @@ func TestContext(t *testing.T) {
 			"3": "B",
 		})
 		logger.Debug(ctx, "Message")
-		assertEntry(t, logEntry{
+		assertEntry(t, Entry{
 			Message: "Message",
 			Level:   debugLevel,
 			Fields: map[string]interface{}{
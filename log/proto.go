@@ -0,0 +1,35 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoEmitDefaults includes unpopulated fields when encoding proto.Message
+// field values.
+func ProtoEmitDefaults() LoggerOption {
+	return func(o *loggerOptions) {
+		o.protoJSON.EmitUnpopulated = true
+	}
+}
+
+// ProtoEnumsAsInts encodes enums in proto.Message field values as numbers
+// rather than names.
+func ProtoEnumsAsInts() LoggerOption {
+	return func(o *loggerOptions) {
+		o.protoJSON.UseEnumNumbers = true
+	}
+}
+
+// protoField encodes the message with protojson, which unlike encoding/json
+// uses the proto JSON names and handles oneofs, enums and well-known types.
+func protoField(msg proto.Message, marshalOptions protojson.MarshalOptions) interface{} {
+	msgJSON, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("Marshal Error: %s", err.Error())
+	}
+	return json.RawMessage(msgJSON)
+}
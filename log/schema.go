@@ -0,0 +1,73 @@
+package log
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EntrySchemaVersion identifies the format of Entry. It changes only when the
+// format changes in a way which would break a parser of the previous version.
+const EntrySchemaVersion = "v1"
+
+// Entry is a single log entry as emitted by JSONLog, one per line.
+type Entry struct {
+	// Schema is EntrySchemaVersion when the IncludeSchema option is set,
+	// otherwise omitted.
+	Schema string `json:"schema,omitempty"`
+
+	// Level is the slog level name, e.g. DEBUG, INFO, WARN, ERROR
+	Level string `json:"level"`
+
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+
+	// Fields are the key/value pairs from the context and call. Values which
+	// are errors or fmt.Stringers are emitted as strings.
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// IncludeSchema adds the top level schema field to each entry, set to
+// EntrySchemaVersion.
+func IncludeSchema() LoggerOption {
+	return func(o *loggerOptions) {
+		o.includeSchema = true
+	}
+}
+
+// EntrySchema returns a JSON Schema describing Entry at EntrySchemaVersion,
+// for validating the output of JSONLog.
+func EntrySchema() []byte {
+	schema := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "https://github.com/pentops/log.go/schema/entry/" + EntrySchemaVersion,
+		"title":   "Log Entry",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"schema": map[string]interface{}{
+				"type":  "string",
+				"const": EntrySchemaVersion,
+			},
+			"level": map[string]interface{}{
+				"type":    "string",
+				"pattern": "^(DEBUG|INFO|WARN|ERROR)([+-][0-9]+)?$",
+			},
+			"time": map[string]interface{}{
+				"type":   "string",
+				"format": "date-time",
+			},
+			"message": map[string]interface{}{
+				"type": "string",
+			},
+			"fields": map[string]interface{}{
+				"type":                 []string{"object", "null"},
+				"additionalProperties": true,
+			},
+		},
+		"required":             []string{"level", "time", "message", "fields"},
+		"additionalProperties": false,
+	}
+
+	// Marshal can't fail for the static structure above
+	schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
+	return schemaJSON
+}
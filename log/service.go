@@ -0,0 +1,89 @@
+package log
+
+import (
+	"context"
+	"os"
+)
+
+// ServiceContext identifies the running service on every entry with the
+// standard fields app, version, env, region and instance. Empty values are
+// omitted.
+type ServiceContext struct {
+	Name        string
+	Version     string
+	Environment string
+	Region      string
+	InstanceID  string
+}
+
+func (sc ServiceContext) LogFieldsFromContext(context.Context) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for key, val := range map[string]string{
+		"app":      sc.Name,
+		"version":  sc.Version,
+		"env":      sc.Environment,
+		"region":   sc.Region,
+		"instance": sc.InstanceID,
+	} {
+		if val != "" {
+			fields[key] = val
+		}
+	}
+	return fields
+}
+
+// ServiceContextFromEnv reads SERVICE_NAME, SERVICE_VERSION, SERVICE_ENV,
+// SERVICE_REGION (or AWS_REGION) and SERVICE_INSTANCE (or HOSTNAME).
+func ServiceContextFromEnv() ServiceContext {
+	return ServiceContext{
+		Name:        os.Getenv("SERVICE_NAME"),
+		Version:     os.Getenv("SERVICE_VERSION"),
+		Environment: os.Getenv("SERVICE_ENV"),
+		Region:      getenvFallback("SERVICE_REGION", "AWS_REGION"),
+		InstanceID:  getenvFallback("SERVICE_INSTANCE", "HOSTNAME"),
+	}
+}
+
+func getenvFallback(keys ...string) string {
+	for _, key := range keys {
+		if val := os.Getenv(key); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+var serviceContext *ServiceContext
+
+type collectorUpdater interface {
+	updateCollectors(func([]ContextCollector) []ContextCollector)
+}
+
+// SetServiceContext adds the service fields to every entry from
+// DefaultLogger, replacing any previously set ServiceContext, including the
+// one installed at init when SERVICE_NAME is set.
+//
+// On a CallbackLogger the service fields are collected first, so a field of
+// the same name set on the context, e.g. with WithField, takes precedence. On
+// other loggers the ServiceContext is added with AddCollector, and a previous
+// one can't be removed.
+func SetServiceContext(sc ServiceContext) {
+	previous := serviceContext
+	serviceContext = &sc
+
+	updater, ok := DefaultLogger.(collectorUpdater)
+	if !ok {
+		DefaultLogger.AddCollector(sc)
+		return
+	}
+	updater.updateCollectors(func(current []ContextCollector) []ContextCollector {
+		collectors := make([]ContextCollector, 0, len(current)+1)
+		collectors = append(collectors, sc)
+		for _, existing := range current {
+			if previous == nil || !sameCollector(existing, *previous) {
+				collectors = append(collectors, existing)
+			}
+		}
+		return collectors
+	})
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestServiceContext(t *testing.T) {
+	logger, entries := captureLogger()
+	DefaultLogger = logger
+	logger.SetLevel(slog.LevelInfo)
+	defer func() { serviceContext = nil }()
+
+	ctx := context.Background()
+
+	SetServiceContext(ServiceContext{
+		Name:    "svc",
+		Version: "1",
+	})
+	Info(ctx, "Message")
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields: map[string]interface{}{
+			"app":     "svc",
+			"version": "1",
+		},
+	}, entries)
+
+	SetServiceContext(ServiceContext{
+		Name:        "svc",
+		Version:     "2",
+		Environment: "prod",
+	})
+	if collectors := logger.currentCollectors(); len(collectors) != 2 {
+		t.Errorf("want previous service context removed, got %d collectors", len(collectors))
+	}
+	Info(ctx, "Message")
+	got := entries.entries[0]
+	if _, ok := got.Fields["region"]; ok {
+		t.Errorf("empty service fields should be omitted")
+	}
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields: map[string]interface{}{
+			"app":     "svc",
+			"version": "2",
+			"env":     "prod",
+		},
+	}, entries)
+}
+
+func TestServiceContextPrecedence(t *testing.T) {
+	logger, entries := captureLogger()
+	DefaultLogger = logger
+	logger.SetLevel(slog.LevelInfo)
+	defer func() { serviceContext = nil }()
+
+	SetServiceContext(ServiceContext{
+		Name:    "svc",
+		Version: "1",
+	})
+	ctx := WithField(context.Background(), "version", "v2 api")
+	Info(ctx, "Message")
+	assertEntry(t, Entry{
+		Message: "Message",
+		Level:   infoLevel,
+		Fields: map[string]interface{}{
+			"app":     "svc",
+			"version": "v2 api",
+		},
+	}, entries)
+}
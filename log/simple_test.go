@@ -2,16 +2,22 @@ package log
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"testing"
+
+	"github.com/fatih/color"
+	"google.golang.org/protobuf/types/known/typepb"
 )
 
 func TestSimpleFormatter(t *testing.T) {
 
 	buff := bytes.NewBuffer([]byte{})
 
-	jsonFormatter(buff, logEntry{
+	jsonFormatter(buff, Entry{
 		Level:   "DEBUG",
 		Message: "Message",
 		Fields: map[string]interface{}{
@@ -41,7 +47,7 @@ func TestSimpleFormatterError(t *testing.T) {
 
 	buff := bytes.NewBuffer([]byte{})
 
-	jsonFormatter(buff, logEntry{
+	jsonFormatter(buff, Entry{
 		Level:   "DEBUG",
 		Message: "Message",
 		Fields: map[string]interface{}{
@@ -60,3 +66,159 @@ func TestSimpleFormatterError(t *testing.T) {
 	}
 
 }
+
+func TestSplitByLevel(t *testing.T) {
+	stdout := bytes.NewBuffer([]byte{})
+	stderr := bytes.NewBuffer([]byte{})
+
+	logFunc := SplitByLevel(stdout, stderr, slog.LevelError)
+	logFunc("INFO", "Info Message", map[string]interface{}{})
+	logFunc("WARN", "Warn Message", map[string]interface{}{})
+	logFunc("ERROR", "Error Message", map[string]interface{}{})
+
+	if got := strings.Count(stdout.String(), "\n"); got != 2 {
+		t.Errorf("want 2 lines in stdout, got %d: %s", got, stdout.String())
+	}
+	if got := strings.Count(stderr.String(), "\n"); got != 1 {
+		t.Errorf("want 1 line in stderr, got %d: %s", got, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Error Message") {
+		t.Errorf("want error in stderr, got %s", stderr.String())
+	}
+}
+
+func TestEntrySchema(t *testing.T) {
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(EntrySchema(), &schema); err != nil {
+		t.Fatalf("Error decoding schema: %s", err.Error())
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	JSONLog(buff, IncludeSchema())("INFO", "Message", map[string]interface{}{})
+
+	logged := map[string]interface{}{}
+	if err := json.Unmarshal(buff.Bytes(), &logged); err != nil {
+		t.Fatalf("Error decoding log message: %s", err.Error())
+	}
+	if logged["schema"] != EntrySchemaVersion {
+		t.Errorf("Want schema %s, got %v", EntrySchemaVersion, logged["schema"])
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	for key := range logged {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("Logged key %s not in schema", key)
+		}
+	}
+}
+
+func TestJSONLogProtoFields(t *testing.T) {
+	field := &typepb.Field{
+		Kind:     typepb.Field_TYPE_STRING,
+		JsonName: "fooBar",
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options []LoggerOption
+		want    string
+	}{{
+		name: "Default",
+		want: `{"kind":"TYPE_STRING","jsonName":"fooBar"}`,
+	}, {
+		name:    "EnumsAsInts",
+		options: []LoggerOption{ProtoEnumsAsInts()},
+		want:    `{"kind":9,"jsonName":"fooBar"}`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			buff := bytes.NewBuffer([]byte{})
+			JSONLog(buff, tc.options...)("INFO", "Message", map[string]interface{}{
+				"field": field,
+			})
+
+			logged := struct {
+				Fields map[string]json.RawMessage `json:"fields"`
+			}{}
+			if err := json.Unmarshal(buff.Bytes(), &logged); err != nil {
+				t.Fatalf("Error decoding log message: %s", err.Error())
+			}
+
+			compact := bytes.NewBuffer([]byte{})
+			if err := json.Compact(compact, logged.Fields["field"]); err != nil {
+				t.Fatalf("Error compacting field: %s", err.Error())
+			}
+			if compact.String() != tc.want {
+				t.Errorf("Want field %s, got %s", tc.want, compact.String())
+			}
+		})
+	}
+
+	t.Run("EmitDefaults", func(t *testing.T) {
+		buff := bytes.NewBuffer([]byte{})
+		JSONLog(buff, ProtoEmitDefaults())("INFO", "Message", map[string]interface{}{
+			"field": field,
+		})
+		if !strings.Contains(buff.String(), `"cardinality":"CARDINALITY_UNKNOWN"`) {
+			t.Errorf("Want default fields, got %s", buff.String())
+		}
+	})
+}
+
+func TestPrettyLog(t *testing.T) {
+	color.NoColor = true
+
+	buff := bytes.NewBuffer([]byte{})
+	PrettyLog(buff, SkipFields("app"), PrettySeparator(""), PrettyPrefix("svc"))("INFO", "Message", map[string]interface{}{
+		"b":   "2",
+		"a":   1,
+		"app": "skipped",
+	})
+
+	want := "svc: INFO: Message\n| a: 1\n| b: 2\n"
+	if buff.String() != want {
+		t.Errorf("Want:\n%s\nGot:\n%s", want, buff.String())
+	}
+}
+
+type countingWriter struct {
+	writes int
+}
+
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	cw.writes++
+	return len(data), nil
+}
+
+func TestPrettyLogSingleWrite(t *testing.T) {
+	out := &countingWriter{}
+	logFunc := PrettyLog(out)
+	logFunc("INFO", "Message", map[string]interface{}{"a": 1, "b": "2"})
+	logFunc("INFO", "Message", map[string]interface{}{"a": 1})
+
+	if out.writes != 2 {
+		t.Errorf("Want one write per entry, got %d", out.writes)
+	}
+}
+
+func TestSlogAttrs(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	logger := NewCallbackLogger(JSONLog(buff))
+
+	logger.ErrorContext(context.Background(), "Message",
+		"n", 5,
+		"g", slog.GroupValue(slog.Int("a", 1), slog.Group("inner", slog.String("b", "c"))),
+	)
+
+	logged := struct {
+		Fields map[string]json.RawMessage `json:"fields"`
+	}{}
+	if err := json.Unmarshal(buff.Bytes(), &logged); err != nil {
+		t.Fatalf("Error decoding log message: %s", err.Error())
+	}
+	if got := string(logged.Fields["n"]); got != `5` {
+		t.Errorf("Want n 5, got %s", got)
+	}
+	if got := string(logged.Fields["g"]); got != `{"a":1,"inner":{"b":"c"}}` {
+		t.Errorf("Want group as object, got %s", got)
+	}
+}
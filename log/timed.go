@@ -0,0 +1,35 @@
+package log
+
+import (
+	"context"
+	"time"
+)
+
+// SlowThreshold is the duration above which a Timed operation which succeeded
+// is logged at warn rather than info. Zero disables slow detection. Set from
+// LOG_SLOW_THRESHOLD (e.g. "500ms") at init.
+var SlowThreshold time.Duration
+
+// Timed runs the callback, logging the start at debug and the outcome with the
+// elapsed durationSeconds once it returns. Errors are logged at error, slow
+// (see SlowThreshold) calls at warn, and anything else at info. The error from
+// the callback is returned unchanged.
+func Timed(ctx context.Context, operation string, callback func(context.Context) error) error {
+	ctx = WithField(ctx, "operation", operation)
+	Debug(ctx, "Operation Begin")
+
+	startTime := time.Now()
+	err := callback(ctx)
+	duration := time.Since(startTime)
+
+	logCtx := WithField(ctx, "durationSeconds", duration.Seconds())
+	switch {
+	case err != nil:
+		WithError(logCtx, err).Error("Operation Failed")
+	case SlowThreshold > 0 && duration > SlowThreshold:
+		logCtx.Warn("Operation Slow")
+	default:
+		logCtx.Info("Operation Complete")
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestTimed(t *testing.T) {
+	logger, entries := captureLogger()
+	DefaultLogger = logger
+	logger.SetLevel(slog.LevelInfo)
+
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		err := Timed(ctx, "op", func(ctx context.Context) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		assertEntry(t, Entry{
+			Message: "Operation Complete",
+			Level:   infoLevel,
+			Fields:  map[string]interface{}{"operation": "op"},
+		}, entries)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		wantErr := errors.New("boom")
+		err := Timed(ctx, "op", func(ctx context.Context) error {
+			return wantErr
+		})
+		if err != wantErr {
+			t.Fatalf("want error %v, got %v", wantErr, err)
+		}
+		assertEntry(t, Entry{
+			Message: "Operation Failed",
+			Level:   errorLevel,
+			Fields: map[string]interface{}{
+				"operation": "op",
+				"error":     "boom",
+			},
+		}, entries)
+	})
+
+	t.Run("Slow", func(t *testing.T) {
+		SlowThreshold = time.Millisecond
+		defer func() { SlowThreshold = 0 }()
+
+		err := Timed(ctx, "op", func(ctx context.Context) error {
+			time.Sleep(2 * time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		assertEntry(t, Entry{
+			Message: "Operation Slow",
+			Level:   warnLevel,
+			Fields:  map[string]interface{}{"operation": "op"},
+		}, entries)
+	})
+}